@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"net/http"
+)
+
+var projectRoleRank = map[string]int{
+	model.ProjectRoleViewer:   1,
+	model.ProjectRoleDeployer: 2,
+	model.ProjectRoleOwner:    3,
+}
+
+// authorizeProject loads the project and makes sure the user holds at least the given role on it. Users without
+// any access get ErrProjectNotExists so the existence of the project is not leaked.
+func authorizeProject(ctx context.Context, username, projectId, role string) (*model.Project, error) {
+	project, err := dao.GetProjectById(ctx, projectId)
+	if err != nil {
+		return nil, errors.ErrProjectNotExists
+	}
+
+	userRole := getProjectRole(ctx, project, username)
+	if userRole == "" {
+		return nil, errors.ErrProjectNotExists
+	}
+
+	if projectRoleRank[userRole] < projectRoleRank[role] {
+		return nil, errors.ErrPermissionNotAllowed
+	}
+
+	return project, nil
+}
+
+// getProjectRole returns the role of the user on the project. The user a personal project belongs to is always owner,
+// members of the organization owning a project get their organization role, grants can only raise the role.
+func getProjectRole(ctx context.Context, project *model.Project, username string) string {
+	if project.OrgID == "" && project.UserID == username {
+		return model.ProjectRoleOwner
+	}
+
+	var role string
+	if project.OrgID != "" {
+		if member, err := dao.GetOrganizationMember(ctx, project.OrgID, username); err == nil {
+			role = member.Role
+		}
+	}
+
+	grant, err := dao.GetProjectGrant(ctx, project.ProjectID, username)
+	if err == nil && projectRoleRank[grant.Role] > projectRoleRank[role] {
+		role = grant.Role
+	}
+
+	return role
+}
+
+type ShareProjectReq struct {
+	ProjectID string `json:"project_id" binding:"required"`
+	Username  string `json:"username" binding:"required"`
+	Role      string `json:"role"`
+}
+
+func ShareProjectHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params ShareProjectReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	if _, ok := projectRoleRank[params.Role]; !ok {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, "invalid role: "+params.Role))
+		return
+	}
+
+	project, err := authorizeProject(c.Request.Context(), username, params.ProjectID, model.ProjectRoleOwner)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	if params.Username == project.UserID {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, "user already owns the project"))
+		return
+	}
+
+	if _, err = dao.GetUserByUsername(c.Request.Context(), params.Username); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrUserNotFound))
+		return
+	}
+
+	err = dao.UpsertProjectGrant(c.Request.Context(), &model.ProjectGrant{
+		ProjectID: project.ProjectID,
+		UserID:    params.Username,
+		Role:      params.Role,
+		GrantedBy: username,
+	})
+	if err != nil {
+		log.Errorf("upsert project grant: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+func UnshareProjectHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params ShareProjectReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	// users may always give up their own access.
+	role := model.ProjectRoleOwner
+	if params.Username == username {
+		role = model.ProjectRoleViewer
+	}
+
+	project, err := authorizeProject(c.Request.Context(), username, params.ProjectID, role)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	err = dao.DeleteProjectGrant(c.Request.Context(), project.ProjectID, params.Username)
+	if err != nil {
+		log.Errorf("delete project grant: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+func GetProjectGrantsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	projectId := c.Query("project_id")
+
+	project, err := authorizeProject(c.Request.Context(), username, projectId, model.ProjectRoleViewer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	grants, err := dao.GetProjectGrants(c.Request.Context(), project.ProjectID)
+	if err != nil {
+		log.Errorf("get project grants: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"owner": project.UserID,
+		"list":  grants,
+	}))
+}
+
+type TransferProjectReq struct {
+	ProjectID string `json:"project_id" binding:"required"`
+	Username  string `json:"username" binding:"required"`
+}
+
+// TransferProjectHandler hands the project over to another user, only the user the project belongs to can transfer it.
+func TransferProjectHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params TransferProjectReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	project, err := authorizeProject(c.Request.Context(), username, params.ProjectID, model.ProjectRoleOwner)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	if project.UserID != username {
+		c.JSON(http.StatusOK, respError(errors.ErrPermissionNotAllowed))
+		return
+	}
+
+	if _, err = dao.GetUserByUsername(c.Request.Context(), params.Username); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrUserNotFound))
+		return
+	}
+
+	if err = dao.UpdateProjectOwner(c.Request.Context(), project.ProjectID, params.Username); err != nil {
+		log.Errorf("update project owner: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	// the new owner no longer needs a grant.
+	if err = dao.DeleteProjectGrant(c.Request.Context(), project.ProjectID, params.Username); err != nil {
+		log.Errorf("delete project grant: %v", err)
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
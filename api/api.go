@@ -5,17 +5,14 @@ import (
 	"github.com/Filecoin-Titan/titan/api"
 	"github.com/Filecoin-Titan/titan/api/client"
 	"github.com/Filecoin-Titan/titan/api/types"
-	"github.com/Filecoin-Titan/titan/lib/etcdcli"
+	"github.com/filecoin-project/go-jsonrpc"
 	"github.com/gin-gonic/gin"
 	"github.com/gnasnik/titan-workerd-api/config"
 	"github.com/gnasnik/titan-workerd-api/core/errors"
 	logging "github.com/ipfs/go-log"
-	"go.etcd.io/etcd/api/v3/mvccpb"
-	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"sync"
 )
@@ -27,7 +24,23 @@ var GlobalServer *Server
 type Server struct {
 	cfg        config.Config
 	router     *gin.Engine
-	etcdClient *etcdClient
+	discovery  SchedulerDiscovery
+	schedulers *schedulerSet
+	reconciler *reconciler
+	autoscaler *autoscaler
+	health     *healthChecker
+	rollouts   *rolloutController
+	webhooks   *webhookDispatcher
+	bus        *eventBus
+	poller     *statusPoller
+	logs       LogSource
+	monitor    *schedulerMonitor
+	selectors  *selectorRegistry
+	capacity   *capacityCache
+	nodes      *nodeIndex
+	migrations *migrator
+	transport  *schedulerTransport
+	rpc        *rpcPolicy
 }
 
 type Scheduler struct {
@@ -36,157 +49,235 @@ type Scheduler struct {
 	IP     string
 	Api    api.Scheduler
 	Closer func()
+	// config the scheduler was created from, schedulers are reused across reloads while it is unchanged.
+	config types.SchedulerCfg
 }
 
-type etcdClient struct {
-	cli *etcdcli.Client
-
+type schedulerSet struct {
 	mu         sync.Mutex
 	schedulers []*Scheduler
+	// drained are the urls of the schedulers not selected for new deploys.
+	drained map[string]bool
 }
 
-func newEtcdClient(user, password string, addresses []string) (*etcdClient, error) {
-	os.Setenv("ETCD_USERNAME", user)
-	os.Setenv("ETCD_PASSWORD", password)
+func (set *schedulerSet) setDrained(url string, drained bool) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
 
-	etcd, err := etcdcli.New(addresses)
-	if err != nil {
-		return nil, err
+	if set.drained == nil {
+		set.drained = make(map[string]bool)
 	}
 
-	client := &etcdClient{
-		cli:        etcd,
-		schedulers: make([]*Scheduler, 0),
+	if drained {
+		set.drained[url] = true
+	} else {
+		delete(set.drained, url)
 	}
-
-	return client, nil
 }
 
-func (ec *etcdClient) updateSchedulers(schedulers []*Scheduler) {
-	ec.mu.Lock()
-	defer ec.mu.Unlock()
+func (set *schedulerSet) isDrained(url string) bool {
+	set.mu.Lock()
+	defer set.mu.Unlock()
 
-	ec.schedulers = schedulers
+	return set.drained[url]
 }
 
-func (ec *etcdClient) getSchedulers() []*Scheduler {
-	ec.mu.Lock()
-	defer ec.mu.Unlock()
+// update replaces the schedulers and returns the previous ones which are not kept.
+func (set *schedulerSet) update(schedulers []*Scheduler) []*Scheduler {
+	set.mu.Lock()
+	defer set.mu.Unlock()
 
-	return ec.schedulers
-}
+	kept := make(map[*Scheduler]struct{})
+	for _, scheduler := range schedulers {
+		kept[scheduler] = struct{}{}
+	}
 
-func (ec *etcdClient) loadSchedulerConfigs() (map[string][]*types.SchedulerCfg, error) {
-	resp, err := ec.cli.GetServers(types.NodeScheduler.String())
-	if err != nil {
-		return nil, err
+	var removed []*Scheduler
+	for _, scheduler := range set.schedulers {
+		if _, ok := kept[scheduler]; !ok {
+			removed = append(removed, scheduler)
+		}
 	}
 
-	schedulerConfigs := make(map[string][]*types.SchedulerCfg)
+	set.schedulers = schedulers
 
-	for _, kv := range resp.Kvs {
-		var configScheduler *types.SchedulerCfg
-		err := etcdcli.SCUnmarshal(kv.Value, &configScheduler)
-		if err != nil {
-			return nil, err
-		}
-		configs, ok := schedulerConfigs[configScheduler.AreaID]
-		if !ok {
-			configs = make([]*types.SchedulerCfg, 0)
-		}
-		configs = append(configs, configScheduler)
+	return removed
+}
 
-		schedulerConfigs[configScheduler.AreaID] = configs
+// replace swaps a scheduler for its updated copy, it reports false when the scheduler is gone.
+func (set *schedulerSet) replace(old, scheduler *Scheduler) bool {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	schedulers := make([]*Scheduler, len(set.schedulers))
+	copy(schedulers, set.schedulers)
+
+	for i, s := range schedulers {
+		if s == old {
+			schedulers[i] = scheduler
+			set.schedulers = schedulers
+			return true
+		}
 	}
 
-	return schedulerConfigs, nil
+	return false
 }
 
-func (s *Server) watchEtcdSchedulerConfig(ctx context.Context) {
-	watchChan := s.etcdClient.cli.WatchServers(context.Background(), types.NodeScheduler.String())
-	for {
-		resp, ok := <-watchChan
-		if !ok {
-			log.Errorf("close watch chan")
+func (set *schedulerSet) get() []*Scheduler {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	return set.schedulers
+}
+
+// watchSchedulers reloads the schedulers every time the discovery reports a change.
+func (s *Server) watchSchedulers(ctx context.Context) {
+	s.discovery.Watch(ctx, func() {
+		if err := s.reloadSchedulers(ctx); err != nil {
+			log.Errorf("reload schedulers: %v", err)
 			return
 		}
 
-		for _, event := range resp.Events {
-			switch event.Type {
-			case mvccpb.DELETE, mvccpb.PUT:
-				log.Infof("Etcd Scheduler config changed")
-				schedulers, err := s.fetchSchedulersFromEtcd(ctx)
-				if err != nil {
-					log.Errorf("FetchSchedulersFromEtcd: %v", err)
-					continue
-				}
+		log.Infof("Updated Schedulers")
+	})
+}
 
-				s.etcdClient.updateSchedulers(schedulers)
+func (s *Server) GetSchedulers() []*Scheduler {
+	return s.schedulers.get()
+}
 
-				log.Infof("Updated Scheduler from etcd")
-			}
+// GetAvailableSchedulers returns the schedulers whose circuit breaker is closed.
+func (s *Server) GetAvailableSchedulers() []*Scheduler {
+	var out []*Scheduler
+	for _, scheduler := range s.GetSchedulers() {
+		if s.monitor.available(scheduler) {
+			out = append(out, scheduler)
 		}
 	}
+
+	return out
 }
 
-func (s *Server) GetSchedulers() []*Scheduler {
-	return s.etcdClient.getSchedulers()
+// GetSelectableSchedulers returns the available schedulers which are not drained, the ones new deploys may go to.
+func (s *Server) GetSelectableSchedulers() []*Scheduler {
+	var out []*Scheduler
+	for _, scheduler := range s.GetAvailableSchedulers() {
+		if !s.schedulers.isDrained(scheduler.Url) {
+			out = append(out, scheduler)
+		}
+	}
+
+	return out
 }
 
-func (s *Server) fetchSchedulersFromEtcd(ctx context.Context) ([]*Scheduler, error) {
-	schedulerConfigs, err := s.etcdClient.loadSchedulerConfigs()
+// fetchSchedulers loads the scheduler configs and returns the schedulers for them, the current schedulers whose
+// config is unchanged are reused.
+func (s *Server) fetchSchedulers(ctx context.Context) ([]*Scheduler, error) {
+	schedulerConfigs, err := s.discovery.Load(ctx)
 	if err != nil {
-		log.Errorf("load scheduer from etcd: %v", err)
+		log.Errorf("load schedulers: %v", err)
 		return nil, err
 	}
 
+	current := make(map[types.SchedulerCfg]*Scheduler)
+	for _, scheduler := range s.schedulers.get() {
+		current[scheduler.config] = scheduler
+	}
+
 	var schedulers []*Scheduler
 
 	for key, schedulerURLs := range schedulerConfigs {
 		for _, schedulerCfg := range schedulerURLs {
-			// https protocol still in test, we use http for now.
-			schedulerURL := strings.Replace(schedulerCfg.SchedulerURL, "https", "http", 1)
-			headers := http.Header{}
-			headers.Add("Authorization", "Bearer "+schedulerCfg.AccessToken)
-			clientInit, closeScheduler, err := client.NewScheduler(ctx, schedulerURL, headers)
-			if err != nil {
-				log.Errorf("create Scheduler rpc client: %v", err)
+			cfg := *schedulerCfg
+			cfg.AreaID = key
+
+			if scheduler, ok := current[cfg]; ok {
+				schedulers = append(schedulers, scheduler)
+				continue
 			}
 
-			sUrl, err := url.Parse(schedulerCfg.SchedulerURL)
+			scheduler, err := s.newScheduler(ctx, cfg)
 			if err != nil {
-				log.Errorf("parse scheduler url: %v", err)
+				log.Errorf("create scheduler %s: %v", cfg.SchedulerURL, err)
+				continue
 			}
 
-			var schedulerIP string
+			schedulers = append(schedulers, scheduler)
+		}
+	}
 
-			sIP := net.ParseIP(sUrl.Host)
-			if sIP.String() != "" {
-				schedulerIP = sIP.String()
-			} else {
-				addr, err := net.ResolveIPAddr("ip", sIP.String())
-				if err != nil {
-					log.Errorf("resolove ip addr: %v", err)
-				}
-
-				if addr != nil {
-					schedulerIP = addr.IP.String()
-				}
-			}
+	log.Infof("fetch %d schedulers", len(schedulers))
+
+	return schedulers, nil
+}
+
+func (s *Server) newScheduler(ctx context.Context, cfg types.SchedulerCfg) (*Scheduler, error) {
+	httpClient, err := s.transport.httpClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := http.Header{}
+	headers.Add("Authorization", "Bearer "+cfg.AccessToken)
+	clientInit, closeScheduler, err := client.NewScheduler(ctx, cfg.SchedulerURL, headers, jsonrpc.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+
+	schedulerIP, err := resolveSchedulerIP(cfg.SchedulerURL)
+	if err != nil {
+		log.Errorf("resolve scheduler ip: %v", err)
+	}
+
+	return &Scheduler{
+		Url:    cfg.SchedulerURL,
+		Api:    newSchedulerClient(clientInit, cfg, s.rpc),
+		IP:     schedulerIP,
+		AreaId: cfg.AreaID,
+		Closer: closeScheduler,
+		config: cfg,
+	}, nil
+}
 
-			schedulers = append(schedulers, &Scheduler{
-				Url:    schedulerURL,
-				Api:    clientInit,
-				IP:     schedulerIP,
-				AreaId: key,
-				Closer: closeScheduler,
-			})
+// resolveSchedulerIP returns the ip of the host of the scheduler url.
+func resolveSchedulerIP(schedulerURL string) (string, error) {
+	sUrl, err := url.Parse(schedulerURL)
+	if err != nil {
+		return "", err
+	}
+
+	host := sUrl.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+
+	addr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return "", err
+	}
+
+	return addr.IP.String(), nil
+}
+
+// reloadSchedulers replaces the schedulers with the ones of the current configs and closes the clients of the
+// schedulers which are gone.
+func (s *Server) reloadSchedulers(ctx context.Context) error {
+	schedulers, err := s.fetchSchedulers(ctx)
+	if err != nil {
+		return err
+	}
+
+	removed := s.schedulers.update(schedulers)
+	for _, scheduler := range removed {
+		log.Infof("close scheduler %s %s", scheduler.AreaId, scheduler.Url)
+		if scheduler.Closer != nil {
+			scheduler.Closer()
 		}
 	}
 
-	log.Infof("fetch %d schedulers from Etcd", len(schedulers))
+	go s.nodes.rebuild(ctx)
 
-	return schedulers, nil
+	return nil
 }
 
 func NewServer(cfg config.Config) (*Server, error) {
@@ -198,29 +289,71 @@ func NewServer(cfg config.Config) (*Server, error) {
 
 	RegisterRouter(router, cfg)
 
-	ec, err := newEtcdClient(cfg.EtcdUser, cfg.EtcdPassword, cfg.EtcdAddresses)
+	discovery, err := newSchedulerDiscovery(cfg)
 	if err != nil {
-		log.Errorf("New etcdClient Failed: %v", err)
 		return nil, err
 	}
 
 	s := &Server{
 		cfg:        cfg,
 		router:     router,
-		etcdClient: ec,
+		discovery:  discovery,
+		schedulers: &schedulerSet{},
+		reconciler: newReconciler(cfg.Reconcile.Interval, cfg.Reconcile.Policy),
+		health:     newHealthChecker(cfg.HealthCheck.Interval, cfg.HealthCheck.Retention),
+		rollouts:   newRolloutController(cfg.Rollout.Interval),
+		webhooks:   newWebhookDispatcher(cfg.Webhook),
+		bus:        newEventBus(),
+		logs:       newLogSource(cfg.Logs),
+		monitor:    newSchedulerMonitor(cfg.Scheduler),
+		capacity:   newCapacityCache(cfg.Capacity),
+		nodes:      newNodeIndex(cfg.NodeIndex.Interval),
+		migrations: newMigrator(cfg.Migration.Interval, cfg.Migration.HealthTimeout),
+		rpc:        newRPCPolicy(cfg.SchedulerRPC),
 	}
+	s.poller = newStatusPoller(cfg.Stream.PollInterval, s.bus)
 
-	schedulers, err := s.fetchSchedulersFromEtcd(context.Background())
+	s.transport, err = newSchedulerTransport(cfg.SchedulerTLS)
 	if err != nil {
+		log.Errorf("scheduler tls: %v", err)
 		return nil, err
 	}
 
-	s.etcdClient.updateSchedulers(schedulers)
+	s.selectors, err = newSelectorRegistry(cfg.Selector)
+	if err != nil {
+		log.Errorf("scheduler selectors: %v", err)
+		return nil, err
+	}
 
-	go s.watchEtcdSchedulerConfig(context.Background())
+	var provider MetricsProvider = noopMetricsProvider{}
+	if cfg.Autoscale.MetricsURL != "" {
+		provider = NewHTTPMetricsProvider(cfg.Autoscale.MetricsURL)
+	}
+	s.autoscaler = newAutoscaler(cfg.Autoscale.Interval, provider)
 
+	schedulers, err := s.fetchSchedulers(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	s.schedulers.update(schedulers)
+
+	// the background loops reach the server through GlobalServer.
 	GlobalServer = s
 
+	go s.watchSchedulers(context.Background())
+	go s.reconciler.run(context.Background())
+	go s.autoscaler.run(context.Background())
+	go s.health.run(context.Background())
+	go s.rollouts.run(context.Background())
+	go s.webhooks.run(context.Background())
+	go s.poller.run(context.Background())
+	go s.monitor.run(context.Background())
+	go s.capacity.run(context.Background())
+	go s.nodes.run(context.Background())
+	go s.migrations.run(context.Background())
+	go s.nodes.rebuild(context.Background())
+
 	return s, nil
 }
 
@@ -234,7 +367,7 @@ func (s *Server) Run() {
 func (s *Server) Close() {}
 
 func GetSchedulerByAreaId(areaId string) (*Scheduler, error) {
-	schedulers := GlobalServer.GetSchedulers()
+	schedulers := GlobalServer.GetAvailableSchedulers()
 
 	for _, scheduler := range schedulers {
 		if scheduler.AreaId == areaId {
@@ -245,17 +378,9 @@ func GetSchedulerByAreaId(areaId string) (*Scheduler, error) {
 	return nil, errors.ErrNoAvailableScheduler
 }
 
+// GetMaybeBestScheduler returns the selectable scheduler whose area shares the longest prefix with areaId.
 func GetMaybeBestScheduler(areaId string) (*Scheduler, error) {
-	schedulers := GlobalServer.GetSchedulers()
-
-	var areaIds []string
-	for _, scheduler := range schedulers {
-		areaIds = append(areaIds, scheduler.AreaId)
-	}
-
-	maybeBest := findBestMatch(areaIds, areaId)
-
-	return GetSchedulerByAreaId(maybeBest)
+	return prefixSelector{}.Select(context.Background(), GlobalServer.GetSelectableSchedulers(), &SelectRequest{AreaID: areaId})
 }
 
 // findBestMatch 用于找出数组中与目标字符串匹配最多的字符串
@@ -290,56 +415,28 @@ func findBestMatch(stringsArr []string, target string) string {
 }
 
 func GetNearestScheduler(ctx context.Context, queryIP string) (*Scheduler, error) {
-	coordinate := NewIPCoordinate()
-
-	var schedulerIPs []string
-	for _, s := range GlobalServer.GetSchedulers() {
-		schedulerIPs = append(schedulerIPs, s.IP)
-	}
-
-	result, err := GetUserNearestIP(ctx, queryIP, schedulerIPs, coordinate)
-	if err != nil {
-		log.Errorf("get nearest ip: %v", err)
-		return nil, err
-	}
-
-	for _, scheduler := range GlobalServer.GetSchedulers() {
-		if scheduler.IP == result {
-			return scheduler, nil
-		}
-	}
-
-	return nil, errors.New("scheduler not found")
+	return nearestSelector{}.Select(ctx, GlobalServer.GetSelectableSchedulers(), &SelectRequest{ClientIP: queryIP})
 }
 
+// GetRandomSchedulerAPI returns a random selectable scheduler, weighted and restricted to the whitelist of the
+// selector config.
 func GetRandomSchedulerAPI() (*Scheduler, error) {
-	schedulers := GlobalServer.GetSchedulers()
+	return GlobalServer.selectors.random.Select(context.Background(), GlobalServer.GetSelectableSchedulers(), &SelectRequest{})
+}
 
-	if len(schedulers) == 0 {
-		return nil, errors.ErrNoAvailableScheduler
+// GetSchedulerByNodeId returns the scheduler owning the node from the node index, the schedulers are probed in
+// parallel on a miss.
+func GetSchedulerByNodeId(ctx context.Context, nodeId string) (*Scheduler, error) {
+	if scheduler, ok := GlobalServer.nodes.lookup(nodeId); ok {
+		return scheduler, nil
 	}
 
-	//  for test
-	//whitelist := []string{"Asia-Hong-Kong-2", "Asia-Hong-Kong-3", "Asia-Hong-Kong-15"}
-	whitelist := []string{"Asia-China-Guangdong-Shenzhen"}
-	for _, s := range schedulers {
-		if s.AreaId == whitelist[rand.Intn(len(whitelist))] {
-			return s, nil
-		}
+	scheduler, err := probeSchedulerByNodeId(ctx, nodeId)
+	if err != nil {
+		return nil, err
 	}
 
-	return schedulers[rand.Intn(len(schedulers))], nil
-}
-
-func GetSchedulerByNodeId(nodeId string) (*Scheduler, error) {
-	schedulers := GlobalServer.GetSchedulers()
+	GlobalServer.nodes.set(nodeId, scheduler)
 
-	for _, scheduler := range schedulers {
-		_, err := scheduler.Api.GetNodeInfo(context.Background(), nodeId)
-		if err == nil {
-			return scheduler, nil
-		}
-	}
-
-	return nil, errors.ErrNoAvailableScheduler
+	return scheduler, nil
 }
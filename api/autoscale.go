@@ -0,0 +1,457 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScaleSchedule overrides the replica bounds of the policy during a daily time window, in UTC. A window whose end is
+// before its start runs over midnight.
+type ScaleSchedule struct {
+	// Days the window applies to, 0 is Sunday, every day when empty.
+	Days        []time.Weekday `json:"days"`
+	Start       string         `json:"start"`
+	End         string         `json:"end"`
+	MinReplicas int64          `json:"min_replicas"`
+	MaxReplicas int64          `json:"max_replicas"`
+}
+
+// ScaleRule keeps the value of a metric per replica around the target, the replicas needed are
+// ceil(replicas * value / target).
+type ScaleRule struct {
+	Metric string  `json:"metric"`
+	Target float64 `json:"target"`
+}
+
+type AutoscalePolicyReq struct {
+	ProjectID   string           `json:"project_id" binding:"required"`
+	MinReplicas int64            `json:"min_replicas"`
+	MaxReplicas int64            `json:"max_replicas"`
+	Cooldown    int64            `json:"cooldown"`
+	Schedules   []*ScaleSchedule `json:"schedules"`
+	Rules       []*ScaleRule     `json:"rules"`
+	Enabled     bool             `json:"enabled"`
+}
+
+type AutoscalePolicy struct {
+	*model.AutoscalePolicy
+	Schedules []*ScaleSchedule `json:"schedules"`
+	Rules     []*ScaleRule     `json:"rules"`
+}
+
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %s", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (s *ScaleSchedule) validate() error {
+	if _, err := parseClock(s.Start); err != nil {
+		return err
+	}
+
+	if _, err := parseClock(s.End); err != nil {
+		return err
+	}
+
+	for _, day := range s.Days {
+		if day < time.Sunday || day > time.Saturday {
+			return fmt.Errorf("invalid day: %d", day)
+		}
+	}
+
+	if s.MaxReplicas > 0 && s.MinReplicas > s.MaxReplicas {
+		return fmt.Errorf("schedule %s-%s: min_replicas is greater than max_replicas", s.Start, s.End)
+	}
+
+	return nil
+}
+
+// active reports whether the window covers the given time.
+func (s *ScaleSchedule) active(now time.Time) bool {
+	now = now.UTC()
+
+	if len(s.Days) > 0 {
+		var found bool
+		for _, day := range s.Days {
+			if day == now.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	start, _ := parseClock(s.Start)
+	end, _ := parseClock(s.End)
+	minute := now.Hour()*60 + now.Minute()
+
+	if start <= end {
+		return minute >= start && minute < end
+	}
+
+	return minute >= start || minute < end
+}
+
+func (req *AutoscalePolicyReq) validate() error {
+	if req.MinReplicas <= 0 {
+		return fmt.Errorf("invalid min_replicas: %d", req.MinReplicas)
+	}
+
+	if req.MaxReplicas < req.MinReplicas {
+		return fmt.Errorf("max_replicas is less than min_replicas")
+	}
+
+	if req.Cooldown < 0 {
+		return fmt.Errorf("invalid cooldown: %d", req.Cooldown)
+	}
+
+	for _, schedule := range req.Schedules {
+		if err := schedule.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, rule := range req.Rules {
+		if rule.Metric == "" || rule.Target <= 0 {
+			return fmt.Errorf("invalid rule: metric %q target %v", rule.Metric, rule.Target)
+		}
+	}
+
+	return nil
+}
+
+func decodeAutoscalePolicy(policy *model.AutoscalePolicy) (*AutoscalePolicy, error) {
+	out := &AutoscalePolicy{AutoscalePolicy: policy}
+
+	if policy.Schedules != "" {
+		if err := json.Unmarshal([]byte(policy.Schedules), &out.Schedules); err != nil {
+			return nil, err
+		}
+	}
+
+	if policy.Rules != "" {
+		if err := json.Unmarshal([]byte(policy.Rules), &out.Rules); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// desiredReplicas evaluates the policy for a project running the given replicas and returns the replicas it should
+// run along with the reason of the decision.
+func (p *AutoscalePolicy) desiredReplicas(current int64, metrics map[string]float64, now time.Time) (int64, string) {
+	minReplicas, maxReplicas := p.MinReplicas, p.MaxReplicas
+
+	var reasons []string
+	for _, schedule := range p.Schedules {
+		if !schedule.active(now) {
+			continue
+		}
+
+		if schedule.MinReplicas > 0 {
+			minReplicas = schedule.MinReplicas
+		}
+		if schedule.MaxReplicas > 0 {
+			maxReplicas = schedule.MaxReplicas
+		}
+
+		reasons = append(reasons, fmt.Sprintf("schedule %s-%s", schedule.Start, schedule.End))
+		break
+	}
+
+	desired := current
+	var ruled bool
+	for _, rule := range p.Rules {
+		value, ok := metrics[rule.Metric]
+		if !ok {
+			continue
+		}
+
+		replicas := int64(math.Ceil(float64(current) * value / rule.Target))
+		if !ruled || replicas > desired {
+			desired = replicas
+		}
+		ruled = true
+
+		reasons = append(reasons, fmt.Sprintf("%s %.2f/%.2f", rule.Metric, value, rule.Target))
+	}
+
+	if desired < minReplicas {
+		desired = minReplicas
+		reasons = append(reasons, fmt.Sprintf("min replicas %d", minReplicas))
+	}
+
+	if desired > maxReplicas {
+		desired = maxReplicas
+		reasons = append(reasons, fmt.Sprintf("max replicas %d", maxReplicas))
+	}
+
+	return desired, strings.Join(reasons, ", ")
+}
+
+type autoscaler struct {
+	interval time.Duration
+	provider MetricsProvider
+}
+
+func newAutoscaler(interval time.Duration, provider MetricsProvider) *autoscaler {
+	return &autoscaler{
+		interval: interval,
+		provider: provider,
+	}
+}
+
+func (a *autoscaler) run(ctx context.Context) {
+	if a.interval <= 0 {
+		log.Infof("autoscaler disabled")
+		return
+	}
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.scaleOnce(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *autoscaler) scaleOnce(ctx context.Context) {
+	policies, err := dao.GetEnabledAutoscalePolicies(ctx)
+	if err != nil {
+		log.Errorf("autoscale: get policies: %v", err)
+		return
+	}
+
+	for _, policy := range policies {
+		if err = a.scaleProject(ctx, policy); err != nil {
+			log.Errorf("autoscale: project %s: %v", policy.ProjectID, err)
+		}
+	}
+}
+
+func (a *autoscaler) scaleProject(ctx context.Context, policy *model.AutoscalePolicy) error {
+	now := time.Now()
+
+	if now.Before(policy.LastScaledAt.Add(time.Duration(policy.Cooldown) * time.Second)) {
+		return nil
+	}
+
+	p, err := decodeAutoscalePolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	project, err := dao.GetProjectById(ctx, policy.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	// scaling is resumed once the rollout or the migration is over.
+	if inRollout(ctx, project.ProjectID) || inMigration(ctx, project.ProjectID) {
+		return nil
+	}
+
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	if len(placements) > 1 {
+		return fmt.Errorf("project is spread over %d areas", len(placements))
+	}
+
+	var metrics map[string]float64
+	if len(p.Rules) > 0 {
+		metrics, err = a.provider.GetProjectMetrics(ctx, project)
+		if err != nil {
+			return err
+		}
+	}
+
+	desired, reason := p.desiredReplicas(project.Replicas, metrics, now)
+	if desired == project.Replicas {
+		return nil
+	}
+
+	event := &model.AutoscaleEvent{
+		ProjectID:    project.ProjectID,
+		FromReplicas: project.Replicas,
+		ToReplicas:   desired,
+		Reason:       reason,
+		Status:       model.AutoscaleStatusApplied,
+	}
+
+	project.Replicas = desired
+	if err = updateProject(ctx, project); err != nil {
+		event.Status = model.AutoscaleStatusFailed
+		event.Error = err.Error()
+	}
+
+	if err := dao.AddAutoscaleEvent(ctx, event); err != nil {
+		log.Errorf("autoscale: add event: %v", err)
+	}
+
+	// failed attempts also wait for the cooldown so a broken scheduler is not hammered.
+	if err := dao.UpdateAutoscaleLastScaledAt(ctx, project.ProjectID, now); err != nil {
+		log.Errorf("autoscale: update last scaled at: %v", err)
+	}
+
+	return err
+}
+
+func SetAutoscalePolicyHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params AutoscalePolicyReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	if err := params.validate(); err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	project, err := authorizeProject(c.Request.Context(), username, params.ProjectID, model.ProjectRoleDeployer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	placements, err := getProjectPlacements(c.Request.Context(), project)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	if len(placements) > 1 {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, "autoscaling is not supported for projects spread over several areas"))
+		return
+	}
+
+	schedules, _ := json.Marshal(params.Schedules)
+	rules, _ := json.Marshal(params.Rules)
+
+	err = dao.UpsertAutoscalePolicy(c.Request.Context(), &model.AutoscalePolicy{
+		ProjectID:   project.ProjectID,
+		MinReplicas: params.MinReplicas,
+		MaxReplicas: params.MaxReplicas,
+		Cooldown:    params.Cooldown,
+		Schedules:   string(schedules),
+		Rules:       string(rules),
+		Enabled:     params.Enabled,
+	})
+	if err != nil {
+		log.Errorf("upsert autoscale policy: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+func GetAutoscalePolicyHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	projectId := c.Query("project_id")
+
+	project, err := authorizeProject(c.Request.Context(), username, projectId, model.ProjectRoleViewer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	policy, err := dao.GetAutoscalePolicy(c.Request.Context(), project.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrNotFound))
+		return
+	}
+
+	out, err := decodeAutoscalePolicy(policy)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(out))
+}
+
+func DeleteAutoscalePolicyHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params AutoscalePolicyReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	project, err := authorizeProject(c.Request.Context(), username, params.ProjectID, model.ProjectRoleDeployer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	if err = dao.DeleteAutoscalePolicy(c.Request.Context(), project.ProjectID); err != nil {
+		log.Errorf("delete autoscale policy: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+// GetAutoscaleEventsHandler lists the scaling decisions taken for the project, most recent first.
+func GetAutoscaleEventsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	projectId := c.Query("project_id")
+
+	page, _ := strconv.ParseInt(c.Query("page"), 10, 64)
+	size, _ := strconv.ParseInt(c.Query("size"), 10, 64)
+
+	project, err := authorizeProject(c.Request.Context(), username, projectId, model.ProjectRoleViewer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	total, events, err := dao.GetAutoscaleEvents(c.Request.Context(), project.ProjectID, dao.QueryOption{
+		Page:     int(page),
+		PageSize: int(size),
+	})
+	if err != nil {
+		log.Errorf("get autoscale events: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  events,
+		"total": total,
+	}))
+}
@@ -0,0 +1,298 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/Filecoin-Titan/titan/api/types"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BatchOperationDelete         = "delete"
+	BatchOperationRenew          = "renew"
+	BatchOperationUpdateReplicas = "update_replicas"
+	BatchOperationChangeBundle   = "change_bundle"
+)
+
+const (
+	maxBatchSize     = 100
+	batchConcurrency = 8
+)
+
+type BatchReq struct {
+	ProjectIds []string `json:"project_ids"`
+	// Selector picks the projects by label when ProjectIds is empty.
+	Selector   string `json:"selector"`
+	Operation  string `json:"operation"`
+	Replicas   int64  `json:"replicas"`
+	BundleUrl  string `json:"bundle_url"`
+	Expiration string `json:"expiration"`
+}
+
+type BatchResult struct {
+	ProjectID string `json:"project_id"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (req *BatchReq) validate() error {
+	switch req.Operation {
+	case BatchOperationDelete:
+	case BatchOperationRenew:
+		if req.Expiration != "" {
+			if _, err := time.Parse(time.DateTime, req.Expiration); err != nil {
+				return fmt.Errorf("invalid expiration: %s", req.Expiration)
+			}
+		}
+	case BatchOperationUpdateReplicas:
+		if req.Replicas <= 0 {
+			return fmt.Errorf("invalid replicas: %d", req.Replicas)
+		}
+	case BatchOperationChangeBundle:
+		if req.BundleUrl == "" {
+			return fmt.Errorf("bundle_url is required")
+		}
+	default:
+		return fmt.Errorf("unsupported operation: %s", req.Operation)
+	}
+
+	if len(req.ProjectIds) == 0 && req.Selector == "" {
+		return fmt.Errorf("project_ids or selector is required")
+	}
+
+	if len(req.ProjectIds) > maxBatchSize {
+		return fmt.Errorf("at most %d projects per batch", maxBatchSize)
+	}
+
+	return nil
+}
+
+// BatchProjectHandler runs one operation on several projects of the user and reports the result of every project.
+func BatchProjectHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params BatchReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	if err := params.validate(); err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	projectIds := params.ProjectIds
+	if len(projectIds) == 0 {
+		selector, err := parseLabelSelector(params.Selector)
+		if err != nil {
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+			return
+		}
+
+		workspace := getWorkspace(c)
+		if workspace != "" {
+			if _, err = authorizeOrg(c.Request.Context(), username, workspace, model.ProjectRoleViewer); err != nil {
+				c.JSON(http.StatusOK, respError(err))
+				return
+			}
+		}
+
+		projects, err := dao.GetProjectsBySelector(c.Request.Context(), dao.QueryOption{UserID: username, OrgID: workspace, Labels: selector})
+		if err != nil {
+			log.Errorf("get projects by selector: %v", err)
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+			return
+		}
+
+		if len(projects) > maxBatchSize {
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, fmt.Sprintf("selector matches %d projects, at most %d per batch", len(projects), maxBatchSize)))
+			return
+		}
+
+		for _, project := range projects {
+			projectIds = append(projectIds, project.ProjectID)
+		}
+	}
+
+	projectIds = uniqueProjectIds(projectIds)
+
+	results := make([]*BatchResult, len(projectIds))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchConcurrency)
+
+	for i, projectId := range projectIds {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, projectId string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			result := &BatchResult{ProjectID: projectId, Success: true}
+			if err := runBatchOperation(c.Request.Context(), username, projectId, &params); err != nil {
+				result.Success = false
+				result.Error = err.Error()
+			}
+
+			results[i] = result
+		}(i, projectId)
+	}
+
+	wg.Wait()
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": results,
+	}))
+}
+
+// uniqueProjectIds drops the repeated ids, a project must not be operated on concurrently.
+func uniqueProjectIds(projectIds []string) []string {
+	seen := make(map[string]bool)
+
+	var out []string
+	for _, projectId := range projectIds {
+		if !seen[projectId] {
+			seen[projectId] = true
+			out = append(out, projectId)
+		}
+	}
+
+	return out
+}
+
+func runBatchOperation(ctx context.Context, username, projectId string, params *BatchReq) error {
+	role := model.ProjectRoleDeployer
+	if params.Operation == BatchOperationDelete {
+		role = model.ProjectRoleOwner
+	}
+
+	project, err := authorizeProject(ctx, username, projectId, role)
+	if err != nil {
+		return err
+	}
+
+	if err = checkProjectIdle(ctx, project.ProjectID); err != nil {
+		return err
+	}
+
+	switch params.Operation {
+	case BatchOperationDelete:
+		return deleteProject(ctx, project)
+	case BatchOperationRenew:
+		expiration, _ := time.Parse(time.DateTime, params.Expiration)
+		if expiration.IsZero() {
+			expiration = time.Now().AddDate(1, 0, 0)
+		}
+		return renewProject(ctx, project, expiration)
+	case BatchOperationUpdateReplicas:
+		placements, err := getProjectPlacements(ctx, project)
+		if err != nil {
+			return err
+		}
+
+		if len(placements) > 1 {
+			return fmt.Errorf("project is spread over %d areas, update its replica_spread instead", len(placements))
+		}
+
+		project.Replicas = params.Replicas
+		return updateProject(ctx, project)
+	case BatchOperationChangeBundle:
+		project.BundleUrl = params.BundleUrl
+		return updateProject(ctx, project)
+	}
+
+	return fmt.Errorf("unsupported operation: %s", params.Operation)
+}
+
+// renewProject extends the expiration of the project. The expiration is only accepted by DeployProject, so every
+// placement is redeployed with the new expiration, one area after the other so the others keep serving meanwhile.
+// When a placement fails to redeploy, the placements already renewed get their previous deployment back so the
+// expiration stays the same in every area, and the error tells which areas could not be rolled back.
+func renewProject(ctx context.Context, project *model.Project, expiration time.Time) error {
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	renewed := *project
+	renewed.Expiration = expiration
+
+	for i, placement := range placements {
+		scheduler, err := GetSchedulerByAreaId(placement.AreaID)
+		if err == nil {
+			err = redeployPlacement(ctx, scheduler, project, &renewed, placement.Replicas)
+		}
+
+		if err != nil {
+			log.Errorf("api: renew project %s in %s: %v", project.ProjectID, placement.AreaID, err)
+			return undoRenew(ctx, project, &renewed, placements[:i], fmt.Errorf("renew area %s: %w", placement.AreaID, err))
+		}
+	}
+
+	if err = dao.UpdateProjectExpiration(ctx, project.ProjectID, expiration); err != nil {
+		return err
+	}
+
+	notifyEvent(ctx, project.UserID, model.EventProjectDeployed, JsonObject{"project": &renewed})
+
+	return nil
+}
+
+// undoRenew puts the previous deployment back in the areas already renewed, the returned error reports the cause
+// along with the areas still running the renewed deployment.
+func undoRenew(ctx context.Context, previous, renewed *model.Project, placements []*model.ProjectPlacement, cause error) error {
+	errs := []string{cause.Error()}
+
+	for _, placement := range placements {
+		scheduler, err := GetSchedulerByAreaId(placement.AreaID)
+		if err == nil {
+			err = redeployPlacement(ctx, scheduler, renewed, previous, placement.Replicas)
+		}
+
+		if err != nil {
+			log.Errorf("api: roll back renew of project %s in %s: %v", previous.ProjectID, placement.AreaID, err)
+			errs = append(errs, fmt.Sprintf("area %s keeps the expiration %s: %v", placement.AreaID, renewed.Expiration.Format(time.DateTime), err))
+		}
+	}
+
+	return fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+// redeployPlacement replaces the deployment of the project on the scheduler by the renewed one, the previous
+// deployment is put back when the renewed one can not be deployed.
+func redeployPlacement(ctx context.Context, scheduler *Scheduler, previous, renewed *model.Project, replicas int64) error {
+	err := scheduler.Api.DeleteProject(ctx, &types.ProjectReq{UUID: previous.ProjectID})
+	if err != nil && !isProjectNotFoundErr(err) {
+		return fmt.Errorf("delete project: %w", err)
+	}
+
+	req := newDeployProjectReq(renewed)
+	req.Replicas = replicas
+
+	err = schedulerDeploy(ctx, scheduler, req)
+	if err == nil {
+		return nil
+	}
+
+	restore := newDeployProjectReq(previous)
+	restore.Replicas = replicas
+
+	if restoreErr := schedulerDeploy(ctx, scheduler, restore); restoreErr != nil {
+		return fmt.Errorf("deploy project: %v, restore previous deployment: %v", err, restoreErr)
+	}
+
+	return fmt.Errorf("deploy project: %w", err)
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"sync"
+	"time"
+)
+
+const (
+	ProjectEventStatus = "status"
+	ProjectEventDeploy = "deploy"
+)
+
+const (
+	DeployPhaseStarted   = "started"
+	DeployPhaseScheduled = "scheduled"
+	DeployPhaseCompleted = "completed"
+	DeployPhaseFailed    = "failed"
+	DeployPhaseDeleted   = "deleted"
+)
+
+const subscriptionBufferSize = 64
+
+// ProjectEvent is a change of a project published on the event bus: a new state reported by the schedulers or the
+// progress of a deploy job.
+type ProjectEvent struct {
+	Type      string    `json:"type"`
+	ProjectID string    `json:"project_id"`
+	UserID    string    `json:"-"`
+	OrgID     string    `json:"-"`
+	Name      string    `json:"name,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Phase     string    `json:"phase,omitempty"`
+	AreaID    string    `json:"area_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+type subscription struct {
+	Username  string
+	Workspace string
+	C         chan *ProjectEvent
+
+	mu sync.RWMutex
+	// shared are the projects of other users shared with the subscriber, for the personal workspace.
+	shared map[string]bool
+}
+
+func (sub *subscription) setShared(projectIds []string) {
+	shared := make(map[string]bool, len(projectIds))
+	for _, projectId := range projectIds {
+		shared[projectId] = true
+	}
+
+	sub.mu.Lock()
+	sub.shared = shared
+	sub.mu.Unlock()
+}
+
+// receives reports whether the event belongs to the workspace of the subscriber: the projects of the organization,
+// or the personal projects of the subscriber and the ones shared with them.
+func (sub *subscription) receives(event *ProjectEvent) bool {
+	if sub.Workspace != event.OrgID {
+		return false
+	}
+
+	if sub.Workspace != "" || event.UserID == sub.Username {
+		return true
+	}
+
+	sub.mu.RLock()
+	defer sub.mu.RUnlock()
+
+	return sub.shared[event.ProjectID]
+}
+
+// eventBus fans the project events out to the subscribers, events are dropped for subscribers too slow to keep up.
+type eventBus struct {
+	mu          sync.RWMutex
+	subscribers map[*subscription]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		subscribers: make(map[*subscription]struct{}),
+	}
+}
+
+func (b *eventBus) subscribe(username, workspace string) *subscription {
+	sub := &subscription{
+		Username:  username,
+		Workspace: workspace,
+		C:         make(chan *ProjectEvent, subscriptionBufferSize),
+	}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+func (b *eventBus) unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	delete(b.subscribers, sub)
+	b.mu.Unlock()
+}
+
+func (b *eventBus) publish(event *ProjectEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscribers {
+		if !sub.receives(event) {
+			continue
+		}
+
+		select {
+		case sub.C <- event:
+		default:
+			log.Warnf("event bus: drop event of project %s for %s", event.ProjectID, sub.Username)
+		}
+	}
+}
+
+// workspaces returns the distinct workspaces watched by the subscribers.
+func (b *eventBus) workspaces() []*subscription {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	seen := make(map[[2]string]bool)
+
+	var out []*subscription
+	for sub := range b.subscribers {
+		key := [2]string{sub.Username, sub.Workspace}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, sub)
+	}
+
+	return out
+}
+
+// publishProjectEvent publishes the event on the bus of the server, if any.
+func publishProjectEvent(event *ProjectEvent) {
+	if GlobalServer == nil || GlobalServer.bus == nil {
+		return
+	}
+
+	GlobalServer.bus.publish(event)
+}
+
+func newDeployEvent(project *model.Project, phase string) *ProjectEvent {
+	return &ProjectEvent{
+		Type:      ProjectEventDeploy,
+		ProjectID: project.ProjectID,
+		UserID:    project.UserID,
+		OrgID:     project.OrgID,
+		Name:      project.Name,
+		Phase:     phase,
+	}
+}
@@ -0,0 +1,396 @@
+package api
+
+import (
+	"context"
+	"github.com/gnasnik/titan-workerd-api/config"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// deployFailureWindow is the number of recent deploys the failure rate of a scheduler is computed on.
+	deployFailureWindow = 20
+
+	defaultDistanceWeight = 0.4
+	defaultCapacityWeight = 0.4
+	defaultFailureWeight  = 0.2
+
+	// distanceScale is the distance in km at which the distance score halves.
+	distanceScale = 1000.0
+
+	// onDemandCapacityTTL is how long a capacity fetched on demand is used when the background refresh is disabled.
+	onDemandCapacityTTL = time.Minute
+
+	capacityFetchConcurrency = 8
+)
+
+// schedulerCapacity is the cached capacity of a scheduler.
+type schedulerCapacity struct {
+	Regions map[string]int
+	// AvailableNodes is the sum of the nodes of every region of the scheduler.
+	AvailableNodes int
+	// AreaNodes is the number of nodes listed in every region of the scheduler.
+	AreaNodes int
+	Latitude  float64
+	Longitude float64
+	Located   bool
+	UpdatedAt time.Time
+}
+
+// capacityCache keeps the capacity and the recent deploy outcomes of every scheduler by url, the capacity is
+// refreshed in the background and fetched on demand when missing or stale.
+type capacityCache struct {
+	interval time.Duration
+
+	distanceWeight float64
+	capacityWeight float64
+	failureWeight  float64
+
+	mu         sync.Mutex
+	capacities map[string]*schedulerCapacity
+	deploys    map[string][]bool
+}
+
+func newCapacityCache(cfg config.CapacityConfig) *capacityCache {
+	c := &capacityCache{
+		interval:       cfg.Interval,
+		distanceWeight: cfg.DistanceWeight,
+		capacityWeight: cfg.CapacityWeight,
+		failureWeight:  cfg.FailureWeight,
+		capacities:     make(map[string]*schedulerCapacity),
+		deploys:        make(map[string][]bool),
+	}
+
+	if c.distanceWeight == 0 && c.capacityWeight == 0 && c.failureWeight == 0 {
+		c.distanceWeight, c.capacityWeight, c.failureWeight = defaultDistanceWeight, defaultCapacityWeight, defaultFailureWeight
+	}
+
+	return c
+}
+
+func (c *capacityCache) run(ctx context.Context) {
+	if c.interval <= 0 {
+		log.Infof("capacity refresh disabled")
+		return
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.refreshAll(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *capacityCache) refreshAll(ctx context.Context) {
+	schedulers := GlobalServer.GetAvailableSchedulers()
+
+	sem := make(chan struct{}, capacityFetchConcurrency)
+	var wg sync.WaitGroup
+
+	for _, scheduler := range schedulers {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(scheduler *Scheduler) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if _, err := c.refresh(ctx, scheduler); err != nil {
+				log.Errorf("capacity: refresh %s: %v", scheduler.AreaId, err)
+			}
+		}(scheduler)
+	}
+
+	wg.Wait()
+}
+
+func (c *capacityCache) refresh(ctx context.Context, scheduler *Scheduler) (*schedulerCapacity, error) {
+	ctx, cancel := context.WithTimeout(ctx, GlobalServer.monitor.timeout)
+	defer cancel()
+
+	start := time.Now()
+	regions, err := scheduler.Api.GetCurrentRegionInfos(ctx, "")
+	GlobalServer.monitor.record(scheduler, time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+
+	capacity := &schedulerCapacity{Regions: regions, UpdatedAt: time.Now()}
+	for _, count := range regions {
+		capacity.AvailableNodes += count
+	}
+
+	nodes, err := listSchedulerNodes(ctx, scheduler, regions)
+	if err != nil {
+		log.Warnf("capacity: get nodes of %s: %v", scheduler.AreaId, err)
+	} else {
+		GlobalServer.nodes.setSchedulerNodes(scheduler, nodes)
+	}
+	capacity.AreaNodes = len(nodes)
+
+	c.mu.Lock()
+	previous, ok := c.capacities[scheduler.Url]
+	c.mu.Unlock()
+
+	// the location of a scheduler does not change, it is only looked up once.
+	if ok && previous.Located {
+		capacity.Latitude, capacity.Longitude, capacity.Located = previous.Latitude, previous.Longitude, true
+	} else if scheduler.IP != "" {
+		lat, lng, err := NewIPCoordinate().GetLatLng(ctx, scheduler.IP)
+		if err != nil {
+			log.Warnf("capacity: locate %s: %v", scheduler.IP, err)
+		} else {
+			capacity.Latitude, capacity.Longitude, capacity.Located = lat, lng, true
+		}
+	}
+
+	c.mu.Lock()
+	c.capacities[scheduler.Url] = capacity
+	c.mu.Unlock()
+
+	return capacity, nil
+}
+
+// get returns the cached capacity of the scheduler, it is fetched when missing or stale.
+func (c *capacityCache) get(ctx context.Context, scheduler *Scheduler) (*schedulerCapacity, error) {
+	c.mu.Lock()
+	capacity, ok := c.capacities[scheduler.Url]
+	c.mu.Unlock()
+
+	if ok && time.Since(capacity.UpdatedAt) < c.maxAge() {
+		return capacity, nil
+	}
+
+	return c.refresh(ctx, scheduler)
+}
+
+// maxAge is how long a cached capacity is fresh: two refresh intervals, so a late refresh does not force a fetch,
+// or onDemandCapacityTTL when the capacity is only fetched on demand.
+func (c *capacityCache) maxAge() time.Duration {
+	if c.interval <= 0 {
+		return onDemandCapacityTTL
+	}
+	return 2 * c.interval
+}
+
+// getAll returns the capacity of every scheduler, fetching the missing or stale ones concurrently. The capacity of a
+// scheduler which could not be fetched is nil.
+func (c *capacityCache) getAll(ctx context.Context, schedulers []*Scheduler) []*schedulerCapacity {
+	capacities := make([]*schedulerCapacity, len(schedulers))
+
+	sem := make(chan struct{}, capacityFetchConcurrency)
+	var wg sync.WaitGroup
+
+	for i, scheduler := range schedulers {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(i int, scheduler *Scheduler) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			capacity, err := c.get(ctx, scheduler)
+			if err != nil {
+				log.Errorf("capacity: get %s: %v", scheduler.AreaId, err)
+				return
+			}
+			capacities[i] = capacity
+		}(i, scheduler)
+	}
+
+	wg.Wait()
+
+	return capacities
+}
+
+// peek returns the cached capacity of the scheduler without fetching it.
+func (c *capacityCache) peek(scheduler *Scheduler) (*schedulerCapacity, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	capacity, ok := c.capacities[scheduler.Url]
+	return capacity, ok
+}
+
+// forget drops the cached capacity and location of the scheduler.
+func (c *capacityCache) forget(scheduler *Scheduler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.capacities, scheduler.Url)
+}
+
+// recordDeploy feeds the outcome of a deploy to the scheduler into its failure rate.
+func (c *capacityCache) recordDeploy(scheduler *Scheduler, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := append(c.deploys[scheduler.Url], err != nil)
+	if len(results) > deployFailureWindow {
+		results = results[len(results)-deployFailureWindow:]
+	}
+	c.deploys[scheduler.Url] = results
+}
+
+func (c *capacityCache) failureRate(scheduler *Scheduler) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := c.deploys[scheduler.Url]
+	if len(results) == 0 {
+		return 0
+	}
+
+	var failed int
+	for _, r := range results {
+		if r {
+			failed++
+		}
+	}
+
+	return float64(failed) / float64(len(results))
+}
+
+// SchedulerScore is the scoring breakdown of a candidate scheduler, every partial score is between 0 and 1.
+type SchedulerScore struct {
+	Url            string  `json:"url"`
+	AreaId         string  `json:"area_id"`
+	DistanceKm     float64 `json:"distance_km"`
+	DistanceScore  float64 `json:"distance_score"`
+	AvailableNodes int     `json:"available_nodes"`
+	CapacityScore  float64 `json:"capacity_score"`
+	FailureRate    float64 `json:"failure_rate"`
+	FailureScore   float64 `json:"failure_score"`
+	Score          float64 `json:"score"`
+	// Excluded tells why the scheduler can not be selected.
+	Excluded string `json:"excluded,omitempty"`
+}
+
+// scoreSchedulers scores the schedulers by distance to the client, available nodes and deploy failure rate, best
+// first. Schedulers without free nodes are excluded, the distance score is 0 for all when the client can not be
+// located.
+func (c *capacityCache) scoreSchedulers(ctx context.Context, schedulers []*Scheduler, req *SelectRequest) []*SchedulerScore {
+	var (
+		located  bool
+		lat, lng float64
+	)
+
+	if req.ClientIP != "" {
+		var err error
+		lat, lng, err = NewIPCoordinate().GetLatLng(ctx, req.ClientIP)
+		if err != nil {
+			log.Warnf("capacity: locate client %s: %v", req.ClientIP, err)
+		} else {
+			located = true
+		}
+	}
+
+	capacities := c.getAll(ctx, schedulers)
+
+	return c.score(schedulers, capacities, located, lat, lng, req.Region)
+}
+
+// score scores the schedulers from their capacities, see scoreSchedulers. lat and lng are the location of the client
+// when located.
+func (c *capacityCache) score(schedulers []*Scheduler, capacities []*schedulerCapacity, located bool, lat, lng float64, region string) []*SchedulerScore {
+	var maxNodes int
+	for _, capacity := range capacities {
+		if capacity == nil {
+			continue
+		}
+		if nodes := availableNodes(capacity, region); nodes > maxNodes {
+			maxNodes = nodes
+		}
+	}
+
+	out := make([]*SchedulerScore, 0, len(schedulers))
+	for i, scheduler := range schedulers {
+		score := &SchedulerScore{
+			Url:         scheduler.Url,
+			AreaId:      scheduler.AreaId,
+			FailureRate: c.failureRate(scheduler),
+		}
+		score.FailureScore = 1 - score.FailureRate
+		out = append(out, score)
+
+		capacity := capacities[i]
+		if capacity == nil {
+			score.Excluded = "capacity unknown"
+			continue
+		}
+
+		score.AvailableNodes = availableNodes(capacity, region)
+		if score.AvailableNodes == 0 {
+			score.Excluded = "no available nodes"
+			continue
+		}
+		score.CapacityScore = float64(score.AvailableNodes) / float64(maxNodes)
+
+		if located && capacity.Located {
+			score.DistanceKm = calculateDistance(lat, lng, capacity.Latitude, capacity.Longitude)
+			score.DistanceScore = distanceScale / (distanceScale + score.DistanceKm)
+		}
+
+		score.Score = c.distanceWeight*score.DistanceScore + c.capacityWeight*score.CapacityScore + c.failureWeight*score.FailureScore
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if (out[i].Excluded == "") != (out[j].Excluded == "") {
+			return out[i].Excluded == ""
+		}
+		return out[i].Score > out[j].Score
+	})
+
+	return out
+}
+
+// availableNodes returns the nodes of the region when given, else of every region, falling back to the nodes of
+// the area when the scheduler reports no region.
+func availableNodes(capacity *schedulerCapacity, region string) int {
+	if region != "" {
+		return capacity.Regions[region]
+	}
+
+	if capacity.AvailableNodes > 0 || len(capacity.Regions) > 0 {
+		return capacity.AvailableNodes
+	}
+
+	return capacity.AreaNodes
+}
+
+type scoredSelector struct{}
+
+// Select picks the scheduler with the best score, see capacityCache.scoreSchedulers.
+func (scoredSelector) Select(ctx context.Context, schedulers []*Scheduler, req *SelectRequest) (*Scheduler, error) {
+	scores := GlobalServer.capacity.scoreSchedulers(ctx, schedulers, req)
+	return bestScoredScheduler(schedulers, scores)
+}
+
+// bestScoredScheduler returns the scheduler of the best score, by url since an area may have several schedulers.
+func bestScoredScheduler(schedulers []*Scheduler, scores []*SchedulerScore) (*Scheduler, error) {
+	if len(scores) == 0 || scores[0].Excluded != "" {
+		return nil, errors.ErrNoAvailableScheduler
+	}
+
+	for _, scheduler := range schedulers {
+		if scheduler.Url == scores[0].Url {
+			return scheduler, nil
+		}
+	}
+
+	return nil, errors.ErrNoAvailableScheduler
+}
+
+func (scoredSelector) Name() string { return SelectorScored }
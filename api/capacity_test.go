@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/gnasnik/titan-workerd-api/config"
+	"testing"
+	"time"
+)
+
+func newTestCapacityCache() *capacityCache {
+	return newCapacityCache(config.CapacityConfig{})
+}
+
+func TestAvailableNodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity *schedulerCapacity
+		region   string
+		want     int
+	}{
+		{"all regions", &schedulerCapacity{Regions: map[string]int{"a": 2, "b": 3}, AvailableNodes: 5}, "", 5},
+		{"one region", &schedulerCapacity{Regions: map[string]int{"a": 2, "b": 3}, AvailableNodes: 5}, "b", 3},
+		{"missing region", &schedulerCapacity{Regions: map[string]int{"a": 2}, AvailableNodes: 2}, "c", 0},
+		{"no region reported", &schedulerCapacity{AreaNodes: 7}, "", 7},
+		{"empty regions", &schedulerCapacity{Regions: map[string]int{"a": 0}, AreaNodes: 7}, "", 0},
+	}
+
+	for _, tt := range tests {
+		if got := availableNodes(tt.capacity, tt.region); got != tt.want {
+			t.Errorf("%s: availableNodes = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCapacityScore(t *testing.T) {
+	schedulers := []*Scheduler{
+		{Url: "https://a1", AreaId: "Asia-China-Guangdong-Shenzhen"},
+		{Url: "https://a2", AreaId: "Asia-China-Guangdong-Shenzhen"},
+		{Url: "https://b", AreaId: "Europe-Germany-Hesse-Frankfurt"},
+		{Url: "https://c", AreaId: "NorthAmerica-UnitedStates-California-LosAngeles"},
+		{Url: "https://d", AreaId: "Asia-Japan-Tokyo-Tokyo"},
+	}
+
+	capacities := []*schedulerCapacity{
+		{Regions: map[string]int{"r": 10}, AvailableNodes: 10, Latitude: 22.5, Longitude: 114.1, Located: true},
+		{Regions: map[string]int{"r": 40}, AvailableNodes: 40, Latitude: 22.5, Longitude: 114.1, Located: true},
+		{Regions: map[string]int{"r": 40}, AvailableNodes: 40, Latitude: 50.1, Longitude: 8.7, Located: true},
+		{Regions: map[string]int{"r": 0}},
+		nil,
+	}
+
+	c := newTestCapacityCache()
+	for i := 0; i < deployFailureWindow; i++ {
+		c.recordDeploy(schedulers[2], fmt.Errorf("deploy failed"))
+	}
+
+	// the client is in Shenzhen.
+	scores := c.score(schedulers, capacities, true, 22.5, 114.1, "")
+
+	if len(scores) != len(schedulers) {
+		t.Fatalf("got %d scores, want %d", len(scores), len(schedulers))
+	}
+
+	wantOrder := []string{"https://a2", "https://a1", "https://b"}
+	for i, url := range wantOrder {
+		if scores[i].Url != url || scores[i].Excluded != "" {
+			t.Errorf("score %d = %s (excluded %q), want %s", i, scores[i].Url, scores[i].Excluded, url)
+		}
+	}
+
+	excluded := map[string]string{}
+	for _, score := range scores[len(wantOrder):] {
+		excluded[score.Url] = score.Excluded
+	}
+	if excluded["https://c"] != "no available nodes" || excluded["https://d"] != "capacity unknown" {
+		t.Errorf("excluded = %v", excluded)
+	}
+
+	best := scores[0]
+	if best.CapacityScore != 1 || best.FailureScore != 1 || best.DistanceScore != 1 {
+		t.Errorf("best partial scores = %v %v %v, want 1 1 1", best.CapacityScore, best.FailureScore, best.DistanceScore)
+	}
+
+	if scores[2].FailureRate != 1 || scores[2].FailureScore != 0 {
+		t.Errorf("failure rate of %s = %v, want 1", scores[2].Url, scores[2].FailureRate)
+	}
+}
+
+func TestCapacityScoreWithoutClientLocation(t *testing.T) {
+	schedulers := []*Scheduler{{Url: "https://a", AreaId: "a"}, {Url: "https://b", AreaId: "b"}}
+	capacities := []*schedulerCapacity{
+		{Regions: map[string]int{"r": 5}, AvailableNodes: 5, Located: true},
+		{Regions: map[string]int{"r": 10}, AvailableNodes: 10, Located: true},
+	}
+
+	scores := newTestCapacityCache().score(schedulers, capacities, false, 0, 0, "")
+
+	if scores[0].Url != "https://b" {
+		t.Errorf("best = %s, want https://b", scores[0].Url)
+	}
+	for _, score := range scores {
+		if score.DistanceScore != 0 {
+			t.Errorf("%s: distance score = %v, want 0", score.Url, score.DistanceScore)
+		}
+	}
+}
+
+func TestBestScoredScheduler(t *testing.T) {
+	schedulers := []*Scheduler{
+		{Url: "https://a1", AreaId: "area"},
+		{Url: "https://a2", AreaId: "area"},
+	}
+
+	got, err := bestScoredScheduler(schedulers, []*SchedulerScore{{Url: "https://a2", AreaId: "area"}})
+	if err != nil || got != schedulers[1] {
+		t.Errorf("bestScoredScheduler = %v %v, want the scored scheduler of the area", got, err)
+	}
+
+	if _, err = bestScoredScheduler(schedulers, []*SchedulerScore{{Url: "https://a1", Excluded: "no available nodes"}}); err == nil {
+		t.Errorf("bestScoredScheduler selected an excluded scheduler")
+	}
+
+	if _, err = bestScoredScheduler(schedulers, nil); err == nil {
+		t.Errorf("bestScoredScheduler selected a scheduler without scores")
+	}
+}
+
+func TestCapacityCacheGetFresh(t *testing.T) {
+	scheduler := &Scheduler{Url: "https://a", AreaId: "a"}
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		age      time.Duration
+		fresh    bool
+	}{
+		{"refreshed", time.Minute, time.Minute, true},
+		{"refresh late", time.Minute, 3 * time.Minute, false},
+		{"on demand", 0, onDemandCapacityTTL / 2, true},
+		{"on demand expired", 0, 2 * onDemandCapacityTTL, false},
+	}
+
+	for _, tt := range tests {
+		c := newCapacityCache(config.CapacityConfig{Interval: tt.interval})
+		c.capacities[scheduler.Url] = &schedulerCapacity{UpdatedAt: time.Now().Add(-tt.age)}
+
+		if fresh := time.Since(c.capacities[scheduler.Url].UpdatedAt) < c.maxAge(); fresh != tt.fresh {
+			t.Errorf("%s: fresh = %v, want %v", tt.name, fresh, tt.fresh)
+		}
+
+		if tt.fresh {
+			if _, err := c.get(context.Background(), scheduler); err != nil {
+				t.Errorf("%s: get = %v", tt.name, err)
+			}
+		}
+	}
+}
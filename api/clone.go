@@ -0,0 +1,131 @@
+package api
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"github.com/gnasnik/titan-workerd-api/pkg/iptool"
+	"net/http"
+	"time"
+)
+
+type CloneReq struct {
+	ProjectID string `json:"project_id" binding:"required"`
+	// The overrides of the new project, the fields left empty are copied from the project.
+	Name          string           `json:"name"`
+	AreaID        string           `json:"area_id"`
+	Region        string           `json:"region"`
+	NodeIds       string           `json:"node_ids"`
+	Replicas      int64            `json:"replicas"`
+	ReplicaSpread map[string]int64 `json:"replica_spread"`
+}
+
+// CloneProjectHandler copies the spec and the labels of a project the user can view into a new project.
+func CloneProjectHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params CloneReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	source, err := authorizeProject(c.Request.Context(), username, params.ProjectID, model.ProjectRoleViewer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	req, err := newCloneDeployReq(c, source, &params)
+	if err != nil {
+		log.Errorf("clone project: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	if resp := setProjectWorkspace(c, username, req); resp != nil {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	project, err := createProject(c.Request.Context(), username, iptool.GetClientIP(c.Request), req)
+	if err != nil {
+		if err == errors.ErrNoAvailableScheduler {
+			c.JSON(http.StatusOK, respError(err))
+			return
+		}
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"project_id": project.ProjectID,
+	}))
+}
+
+func newCloneDeployReq(c *gin.Context, source *model.Project, params *CloneReq) (*DeployReq, error) {
+	req := &DeployReq{
+		Name:        source.Name,
+		Region:      source.Region,
+		BundleUrl:   source.BundleUrl,
+		Replicas:    source.Replicas,
+		CpuCores:    source.CpuCores,
+		Memory:      source.Memory,
+		Version:     source.Version,
+		Description: source.Description,
+	}
+
+	if source.Expiration.After(time.Now()) {
+		req.Expiration = source.Expiration.Format(time.DateTime)
+	}
+
+	if params.Name != "" {
+		req.Name = params.Name
+	}
+
+	if params.Region != "" {
+		req.Region = params.Region
+	}
+
+	switch {
+	case len(params.ReplicaSpread) > 0:
+		req.ReplicaSpread = params.ReplicaSpread
+	case params.AreaID != "" || params.NodeIds != "":
+		req.AreaID = params.AreaID
+		req.NodeIds = params.NodeIds
+	default:
+		// keep the placement of the project, a project spread over several areas keeps its replicas per area.
+		placements, err := getProjectPlacements(c.Request.Context(), source)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(placements) > 1 {
+			req.ReplicaSpread = make(map[string]int64)
+			for _, placement := range placements {
+				req.ReplicaSpread[placement.AreaID] = placement.Replicas
+			}
+		} else {
+			req.AreaID = source.AreaID
+			req.NodeIds = source.NodeIds
+		}
+	}
+
+	if params.Replicas > 0 {
+		if len(req.ReplicaSpread) > 0 && len(params.ReplicaSpread) == 0 {
+			return nil, errors.New("project is spread over several areas, use replica_spread instead of replicas")
+		}
+		req.Replicas = params.Replicas
+	}
+
+	labels, err := dao.GetProjectLabels(c.Request.Context(), []string{source.ProjectID})
+	if err != nil {
+		return nil, err
+	}
+	req.Labels = labels[source.ProjectID]
+
+	return req, nil
+}
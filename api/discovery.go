@@ -0,0 +1,288 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/Filecoin-Titan/titan/lib/etcdcli"
+	"github.com/gnasnik/titan-workerd-api/config"
+	"github.com/spf13/viper"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DiscoveryEtcd   = "etcd"
+	DiscoveryStatic = "static"
+	DiscoveryFile   = "file"
+)
+
+const defaultSchedulerFileInterval = 5 * time.Second
+
+// SchedulerDiscovery tells which schedulers the api talks to.
+type SchedulerDiscovery interface {
+	// Load returns the scheduler configs by area id.
+	Load(ctx context.Context) (map[string][]*types.SchedulerCfg, error)
+	// Watch calls changed every time the scheduler configs may have changed, until ctx is done.
+	Watch(ctx context.Context, changed func())
+}
+
+func newSchedulerDiscovery(cfg config.Config) (SchedulerDiscovery, error) {
+	switch cfg.Discovery {
+	case DiscoveryStatic:
+		return newStaticDiscovery(cfg.Schedulers), nil
+	case DiscoveryFile:
+		if cfg.SchedulerFile.Path == "" {
+			return nil, fmt.Errorf("scheduler file discovery without a path")
+		}
+		return newFileDiscovery(cfg.SchedulerFile.Path, cfg.SchedulerFile.Interval), nil
+	case DiscoveryEtcd, "":
+		ec, err := newEtcdClient(cfg.EtcdUser, cfg.EtcdPassword, cfg.EtcdAddresses)
+		if err != nil {
+			log.Errorf("New etcdClient Failed: %v", err)
+			return nil, err
+		}
+		return ec, nil
+	default:
+		return nil, fmt.Errorf("unknown scheduler discovery %q", cfg.Discovery)
+	}
+}
+
+// groupSchedulerConfigs groups the scheduler configs by area id.
+func groupSchedulerConfigs(schedulers []config.SchedulerConfig) map[string][]*types.SchedulerCfg {
+	schedulerConfigs := make(map[string][]*types.SchedulerCfg)
+
+	for _, scheduler := range schedulers {
+		schedulerConfigs[scheduler.AreaID] = append(schedulerConfigs[scheduler.AreaID], &types.SchedulerCfg{
+			SchedulerURL: scheduler.URL,
+			AreaID:       scheduler.AreaID,
+			AccessToken:  scheduler.AccessToken,
+		})
+	}
+
+	return schedulerConfigs
+}
+
+const (
+	etcdDialTimeout    = 5 * time.Second
+	etcdRequestTimeout = 10 * time.Second
+	etcdMinBackoff     = time.Second
+	etcdMaxBackoff     = time.Minute
+)
+
+// etcdClient discovers the schedulers registered in etcd, under the same keys as etcdcli.
+type etcdClient struct {
+	cli    *clientv3.Client
+	prefix string
+
+	mu sync.Mutex
+	// revision of the last load or watch response, watches resume after it.
+	revision int64
+}
+
+func newEtcdClient(user, password string, addresses []string) (*etcdClient, error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   addresses,
+		Username:    user,
+		Password:    password,
+		DialTimeout: etcdDialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &etcdClient{
+		cli:    cli,
+		prefix: "/" + types.NodeScheduler.String() + "/",
+	}, nil
+}
+
+func (ec *etcdClient) setRevision(revision int64) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	if revision > ec.revision {
+		ec.revision = revision
+	}
+}
+
+func (ec *etcdClient) getRevision() int64 {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	return ec.revision
+}
+
+func (ec *etcdClient) Load(ctx context.Context) (map[string][]*types.SchedulerCfg, error) {
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+
+	resp, err := ec.cli.Get(ctx, ec.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	schedulerConfigs := make(map[string][]*types.SchedulerCfg)
+
+	for _, kv := range resp.Kvs {
+		var configScheduler *types.SchedulerCfg
+		err := etcdcli.SCUnmarshal(kv.Value, &configScheduler)
+		if err != nil {
+			return nil, err
+		}
+		configs, ok := schedulerConfigs[configScheduler.AreaID]
+		if !ok {
+			configs = make([]*types.SchedulerCfg, 0)
+		}
+		configs = append(configs, configScheduler)
+
+		schedulerConfigs[configScheduler.AreaID] = configs
+	}
+
+	ec.setRevision(resp.Header.Revision)
+
+	return schedulerConfigs, nil
+}
+
+// Watch watches the scheduler keys from the revision after the last load, it reconnects with an exponential backoff
+// when the watch ends and reloads everything when the revision to resume from has been compacted.
+func (ec *etcdClient) Watch(ctx context.Context, changed func()) {
+	backoff := etcdMinBackoff
+
+	for {
+		if ec.watch(ctx, changed) {
+			backoff = etcdMinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		log.Warnf("etcd watch ended, reconnecting from revision %d", ec.getRevision())
+
+		backoff *= 2
+		if backoff > etcdMaxBackoff {
+			backoff = etcdMaxBackoff
+		}
+	}
+}
+
+// watch runs one watch until it fails, it reports whether any response was received.
+func (ec *etcdClient) watch(ctx context.Context, changed func()) (received bool) {
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+
+	watchChan := ec.cli.Watch(ctx, ec.prefix, clientv3.WithPrefix(), clientv3.WithRev(ec.getRevision()+1))
+	for resp := range watchChan {
+		received = true
+
+		if resp.CompactRevision != 0 {
+			log.Warnf("etcd watch revision %d compacted, reloading schedulers", resp.CompactRevision)
+			// the reload moves the revision past the compaction.
+			changed()
+			return
+		}
+
+		if err := resp.Err(); err != nil {
+			log.Errorf("etcd watch: %v", err)
+			return
+		}
+
+		ec.setRevision(resp.Header.Revision)
+
+		// the events of a response are applied by a single reload.
+		for _, event := range resp.Events {
+			if event.Type == mvccpb.DELETE || event.Type == mvccpb.PUT {
+				log.Infof("Etcd Scheduler config changed")
+				changed()
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// staticDiscovery serves the schedulers declared in the config, they never change.
+type staticDiscovery struct {
+	schedulerConfigs map[string][]*types.SchedulerCfg
+}
+
+func newStaticDiscovery(schedulers []config.SchedulerConfig) *staticDiscovery {
+	return &staticDiscovery{schedulerConfigs: groupSchedulerConfigs(schedulers)}
+}
+
+func (d *staticDiscovery) Load(ctx context.Context) (map[string][]*types.SchedulerCfg, error) {
+	return d.schedulerConfigs, nil
+}
+
+func (d *staticDiscovery) Watch(ctx context.Context, changed func()) {
+	<-ctx.Done()
+}
+
+// fileDiscovery reads the schedulers from a toml, json or yaml file holding a Schedulers list like the config,
+// the file is checked for changes every interval.
+type fileDiscovery struct {
+	path     string
+	interval time.Duration
+}
+
+func newFileDiscovery(path string, interval time.Duration) *fileDiscovery {
+	if interval <= 0 {
+		interval = defaultSchedulerFileInterval
+	}
+
+	return &fileDiscovery{path: path, interval: interval}
+}
+
+func (d *fileDiscovery) Load(ctx context.Context) (map[string][]*types.SchedulerCfg, error) {
+	v := viper.New()
+	v.SetConfigFile(d.path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var schedulers []config.SchedulerConfig
+	if err := v.UnmarshalKey("Schedulers", &schedulers); err != nil {
+		return nil, err
+	}
+
+	return groupSchedulerConfigs(schedulers), nil
+}
+
+func (d *fileDiscovery) Watch(ctx context.Context, changed func()) {
+	var modTime time.Time
+	if info, err := os.Stat(d.path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		info, err := os.Stat(d.path)
+		if err != nil {
+			log.Errorf("scheduler file: %v", err)
+			continue
+		}
+
+		if info.ModTime().Equal(modTime) {
+			continue
+		}
+
+		modTime = info.ModTime()
+		log.Infof("Scheduler file %s changed", d.path)
+		changed()
+	}
+}
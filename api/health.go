@@ -0,0 +1,479 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/Filecoin-Titan/titan/api/types"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const healthCheckConcurrency = 8
+
+const (
+	defaultHealthCheckInterval  = 60
+	defaultHealthCheckTimeout   = 5
+	defaultHealthCheckThreshold = 3
+)
+
+type healthTarget struct {
+	URL    string
+	NodeID string
+}
+
+type healthChecker struct {
+	interval  time.Duration
+	retention time.Duration
+	client    *http.Client
+}
+
+func newHealthChecker(interval, retention time.Duration) *healthChecker {
+	return &healthChecker{
+		interval:  interval,
+		retention: retention,
+		client:    &http.Client{},
+	}
+}
+
+func (hc *healthChecker) run(ctx context.Context) {
+	if hc.interval <= 0 {
+		log.Infof("health checker disabled")
+		return
+	}
+
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			hc.checkOnce(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (hc *healthChecker) checkOnce(ctx context.Context) {
+	now := time.Now()
+
+	if hc.retention > 0 {
+		if err := dao.DeleteProjectHealthRecordsBefore(ctx, now.Add(-hc.retention)); err != nil {
+			log.Errorf("health check: delete records: %v", err)
+		}
+	}
+
+	checks, err := dao.GetDueProjectHealthChecks(ctx, now)
+	if err != nil {
+		log.Errorf("health check: get checks: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, healthCheckConcurrency)
+
+	for _, check := range checks {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(check *model.ProjectHealthCheck) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := hc.checkProject(ctx, check); err != nil {
+				log.Errorf("health check: project %s: %v", check.ProjectID, err)
+			}
+		}(check)
+	}
+
+	wg.Wait()
+}
+
+// remediateProject redeploys the project in every area, one area after the other so the others keep serving
+// meanwhile. The replicas of an area are deployed again if the redeployment fails there.
+func remediateProject(ctx context.Context, project *model.Project) error {
+	if err := checkProjectIdle(ctx, project.ProjectID); err != nil {
+		return err
+	}
+
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	for _, placement := range placements {
+		scheduler, err := GetSchedulerByAreaId(placement.AreaID)
+		if err != nil {
+			return err
+		}
+
+		if err = redeployPlacement(ctx, scheduler, project, project, placement.Replicas); err != nil {
+			return fmt.Errorf("area %s: %w", placement.AreaID, err)
+		}
+	}
+
+	return nil
+}
+
+// checkProject probes every target of the project, the project is unhealthy when none of its targets is healthy.
+// After FailureThreshold consecutive failures the project is redeployed if remediation is enabled.
+func (hc *healthChecker) checkProject(ctx context.Context, check *model.ProjectHealthCheck) error {
+	project, err := dao.GetProjectById(ctx, check.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	var records []*model.ProjectHealthRecord
+
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	var areaIds []string
+	for _, placement := range placements {
+		areaIds = append(areaIds, placement.AreaID)
+	}
+
+	// a failure to find the targets tells about the schedulers, not the project: it is recorded without counting
+	// toward the failure threshold.
+	targets, err := resolveHealthTargets(ctx, project.ProjectID, areaIds, check)
+	if err != nil {
+		records = append(records, &model.ProjectHealthRecord{ProjectID: project.ProjectID, Error: err.Error()})
+
+		if err = dao.AddProjectHealthRecords(ctx, records); err != nil {
+			log.Errorf("health check: add records: %v", err)
+		}
+
+		return dao.UpdateProjectHealthCheckResult(ctx, project.ProjectID, check.ConsecutiveFailures, time.Now())
+	}
+
+	healthy := false
+	for _, target := range targets {
+		record := hc.probe(ctx, check, target)
+		record.ProjectID = project.ProjectID
+		healthy = healthy || record.Healthy
+
+		records = append(records, record)
+	}
+
+	failures := int64(0)
+	if !healthy {
+		failures = check.ConsecutiveFailures + 1
+	}
+
+	if len(records) == 0 {
+		records = append(records, &model.ProjectHealthRecord{ProjectID: project.ProjectID, Error: "no replica to probe"})
+	}
+
+	if !healthy && failures == check.FailureThreshold {
+		notifyEvent(ctx, project.UserID, model.EventProjectFailed, JsonObject{"project": project, "error": "health check failed"})
+	}
+
+	if !healthy && check.Remediate && failures >= check.FailureThreshold {
+		log.Infof("health check: remediate project %s after %d failures", project.ProjectID, failures)
+
+		if err = remediateProject(ctx, project); err != nil {
+			log.Errorf("health check: remediate project %s: %v", project.ProjectID, err)
+		} else {
+			records[len(records)-1].Redeployed = true
+			failures = 0
+		}
+	}
+
+	if err = dao.AddProjectHealthRecords(ctx, records); err != nil {
+		log.Errorf("health check: add records: %v", err)
+	}
+
+	return dao.UpdateProjectHealthCheckResult(ctx, project.ProjectID, failures, time.Now())
+}
+
+func (hc *healthChecker) probe(ctx context.Context, check *model.ProjectHealthCheck, target *healthTarget) *model.ProjectHealthRecord {
+	record := &model.ProjectHealthRecord{Target: target.URL, NodeID: target.NodeID}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(check.Timeout)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.URL, nil)
+	if err != nil {
+		record.Error = err.Error()
+		return record
+	}
+
+	start := time.Now()
+	resp, err := hc.client.Do(req)
+	record.Latency = time.Since(start).Milliseconds()
+	if err != nil {
+		record.Error = err.Error()
+		return record
+	}
+	resp.Body.Close()
+
+	record.StatusCode = int64(resp.StatusCode)
+	record.Healthy = record.StatusCode == check.ExpectedStatus
+	if !record.Healthy {
+		record.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+
+	return record
+}
+
+// resolveHealthTargets returns the urls to probe: the tunnel url of the project in every given area, or the endpoint
+// of every node running a replica there. It fails when the replicas are known but none of their nodes could be
+// looked up.
+func resolveHealthTargets(ctx context.Context, projectId string, areaIds []string, check *model.ProjectHealthCheck) ([]*healthTarget, error) {
+	var targets []*healthTarget
+	for _, areaId := range areaIds {
+		scheduler, err := GetSchedulerByAreaId(areaId)
+		if err != nil {
+			return nil, err
+		}
+
+		if check.Mode == model.HealthCheckModeTunnel {
+			tunnel, err := scheduler.Api.GetTunserverURLFromUser(ctx, &types.TunserverReq{AreaID: scheduler.AreaId})
+			if err != nil {
+				return nil, err
+			}
+
+			target, err := tunnelHealthURL(tunnel.URL, check.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			targets = append(targets, &healthTarget{URL: target, NodeID: tunnel.NodeID})
+			continue
+		}
+
+		info, err := scheduler.Api.GetProjectInfo(ctx, projectId)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		resolved := 0
+		for _, replica := range info.DetailsList {
+			node, err := scheduler.Api.GetNodeInfo(ctx, replica.NodeID)
+			if err != nil {
+				log.Errorf("health check: get node info %s: %v", replica.NodeID, err)
+				lastErr = err
+				continue
+			}
+			resolved++
+
+			target := (&url.URL{
+				Scheme: "http",
+				Host:   net.JoinHostPort(node.ExternalIP, strconv.FormatInt(check.Port, 10)),
+				Path:   check.Path,
+			}).String()
+
+			targets = append(targets, &healthTarget{URL: target, NodeID: replica.NodeID})
+		}
+
+		if resolved == 0 && lastErr != nil {
+			return nil, fmt.Errorf("get nodes of area %s: %w", areaId, lastErr)
+		}
+	}
+
+	return targets, nil
+}
+
+// tunnelHealthURL turns the websocket url of a tunnel into the http url of the health check path behind it.
+func tunnelHealthURL(tunnelURL, path string) (string, error) {
+	u, err := url.Parse(tunnelURL)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+
+	u.Path = strings.TrimRight(u.Path, "/") + path
+	return u.String(), nil
+}
+
+type HealthCheckReq struct {
+	ProjectID        string `json:"project_id" binding:"required"`
+	Mode             string `json:"mode"`
+	Path             string `json:"path"`
+	Port             int64  `json:"port"`
+	ExpectedStatus   int64  `json:"expected_status"`
+	Interval         int64  `json:"interval"`
+	Timeout          int64  `json:"timeout"`
+	FailureThreshold int64  `json:"failure_threshold"`
+	Remediate        bool   `json:"remediate"`
+	Enabled          bool   `json:"enabled"`
+}
+
+func (req *HealthCheckReq) validate() error {
+	if req.Mode == "" {
+		req.Mode = model.HealthCheckModeTunnel
+	}
+
+	if req.Mode != model.HealthCheckModeTunnel && req.Mode != model.HealthCheckModeNode {
+		return fmt.Errorf("unsupported mode: %s", req.Mode)
+	}
+
+	if req.Mode == model.HealthCheckModeNode && (req.Port <= 0 || req.Port > 65535) {
+		return fmt.Errorf("invalid port: %d", req.Port)
+	}
+
+	if req.Path == "" {
+		req.Path = "/"
+	}
+
+	if !strings.HasPrefix(req.Path, "/") {
+		return fmt.Errorf("invalid path: %s", req.Path)
+	}
+
+	if req.ExpectedStatus == 0 {
+		req.ExpectedStatus = http.StatusOK
+	}
+
+	if req.Interval <= 0 {
+		req.Interval = defaultHealthCheckInterval
+	}
+
+	if req.Timeout <= 0 {
+		req.Timeout = defaultHealthCheckTimeout
+	}
+
+	if req.FailureThreshold <= 0 {
+		req.FailureThreshold = defaultHealthCheckThreshold
+	}
+
+	return nil
+}
+
+func SetHealthCheckHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params HealthCheckReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	if err := params.validate(); err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	project, err := authorizeProject(c.Request.Context(), username, params.ProjectID, model.ProjectRoleDeployer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	err = dao.UpsertProjectHealthCheck(c.Request.Context(), &model.ProjectHealthCheck{
+		ProjectID:        project.ProjectID,
+		Mode:             params.Mode,
+		Path:             params.Path,
+		Port:             params.Port,
+		ExpectedStatus:   params.ExpectedStatus,
+		CheckInterval:    params.Interval,
+		Timeout:          params.Timeout,
+		FailureThreshold: params.FailureThreshold,
+		Remediate:        params.Remediate,
+		Enabled:          params.Enabled,
+	})
+	if err != nil {
+		log.Errorf("upsert project health check: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+func GetHealthCheckHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	projectId := c.Query("project_id")
+
+	project, err := authorizeProject(c.Request.Context(), username, projectId, model.ProjectRoleViewer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	check, err := dao.GetProjectHealthCheck(c.Request.Context(), project.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrNotFound))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(check))
+}
+
+func DeleteHealthCheckHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params HealthCheckReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	project, err := authorizeProject(c.Request.Context(), username, params.ProjectID, model.ProjectRoleDeployer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	if err = dao.DeleteProjectHealthCheck(c.Request.Context(), project.ProjectID); err != nil {
+		log.Errorf("delete project health check: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+// GetHealthHistoryHandler lists the probe results of the project, most recent first.
+func GetHealthHistoryHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	projectId := c.Query("project_id")
+
+	page, _ := strconv.ParseInt(c.Query("page"), 10, 64)
+	size, _ := strconv.ParseInt(c.Query("size"), 10, 64)
+
+	project, err := authorizeProject(c.Request.Context(), username, projectId, model.ProjectRoleViewer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	total, records, err := dao.GetProjectHealthRecords(c.Request.Context(), project.ProjectID, dao.QueryOption{
+		Page:     int(page),
+		PageSize: int(size),
+	})
+	if err != nil {
+		log.Errorf("get project health records: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  records,
+		"total": total,
+	}))
+}
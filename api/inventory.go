@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type SchedulerInventory struct {
+	AreaId  string           `json:"area_id"`
+	Url     string           `json:"url"`
+	IP      string           `json:"ip"`
+	Drained bool             `json:"drained"`
+	Health  *SchedulerHealth `json:"health"`
+	// RefreshedAt is the last refresh of the capacity and nodes of the scheduler.
+	RefreshedAt    time.Time `json:"refreshed_at"`
+	AvailableNodes int       `json:"available_nodes"`
+	Projects       int64     `json:"projects"`
+}
+
+type SchedulerActionReq struct {
+	Url string `json:"url"`
+	// Drain is used by the drain action, false puts the scheduler back in the selection.
+	Drain bool `json:"drain"`
+}
+
+func errSchedulerDrained(scheduler *Scheduler) error {
+	return fmt.Errorf("scheduler of area %s is drained", scheduler.AreaId)
+}
+
+func findSchedulerByUrl(url string) (*Scheduler, error) {
+	for _, scheduler := range GlobalServer.GetSchedulers() {
+		if scheduler.Url == url {
+			return scheduler, nil
+		}
+	}
+
+	return nil, errors.ErrNotFound
+}
+
+func newSchedulerInventory(scheduler *Scheduler, projects map[string]int64) *SchedulerInventory {
+	out := &SchedulerInventory{
+		AreaId:   scheduler.AreaId,
+		Url:      scheduler.Url,
+		IP:       scheduler.IP,
+		Drained:  GlobalServer.schedulers.isDrained(scheduler.Url),
+		Health:   GlobalServer.monitor.health(scheduler),
+		Projects: projects[scheduler.AreaId],
+	}
+
+	if capacity, ok := GlobalServer.capacity.peek(scheduler); ok {
+		out.RefreshedAt = capacity.UpdatedAt
+		out.AvailableNodes = availableNodes(capacity, "")
+	}
+
+	return out
+}
+
+// bindSchedulerAction binds the action request and returns the scheduler it is about, it writes the error response
+// and returns nil on failure.
+func bindSchedulerAction(c *gin.Context) (*SchedulerActionReq, *Scheduler) {
+	var params SchedulerActionReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return nil, nil
+	}
+
+	scheduler, err := findSchedulerByUrl(params.Url)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return nil, nil
+	}
+
+	return &params, scheduler
+}
+
+func getProjectCounts(ctx context.Context) map[string]int64 {
+	projects, err := dao.CountProjectsByArea(ctx)
+	if err != nil {
+		log.Errorf("count projects by area: %v", err)
+		return map[string]int64{}
+	}
+
+	return projects
+}
+
+// GetSchedulersInventoryHandler lists the schedulers the api knows about.
+func GetSchedulersInventoryHandler(c *gin.Context) {
+	projects := getProjectCounts(c.Request.Context())
+
+	schedulers := GlobalServer.GetSchedulers()
+
+	out := make([]*SchedulerInventory, 0, len(schedulers))
+	for _, scheduler := range schedulers {
+		out = append(out, newSchedulerInventory(scheduler, projects))
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AreaId != out[j].AreaId {
+			return out[i].AreaId < out[j].AreaId
+		}
+		return out[i].Url < out[j].Url
+	})
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  out,
+		"total": len(out),
+	}))
+}
+
+// PingSchedulerHandler probes the scheduler right away, the result feeds its circuit breaker.
+func PingSchedulerHandler(c *gin.Context) {
+	_, scheduler := bindSchedulerAction(c)
+	if scheduler == nil {
+		return
+	}
+
+	if scheduler.Api == nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, "scheduler has no client"))
+		return
+	}
+
+	GlobalServer.monitor.probe(c.Request.Context(), scheduler)
+
+	c.JSON(http.StatusOK, respJSON(GlobalServer.monitor.health(scheduler)))
+}
+
+// RefreshSchedulerHandler refreshes the capacity and the node index entries of the scheduler.
+func RefreshSchedulerHandler(c *gin.Context) {
+	_, scheduler := bindSchedulerAction(c)
+	if scheduler == nil {
+		return
+	}
+
+	if _, err := GlobalServer.capacity.refresh(c.Request.Context(), scheduler); err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(newSchedulerInventory(scheduler, getProjectCounts(c.Request.Context()))))
+}
+
+// DrainSchedulerHandler takes the scheduler out of the selection for new deploys, or puts it back, the projects
+// already running on it are still managed.
+func DrainSchedulerHandler(c *gin.Context) {
+	params, scheduler := bindSchedulerAction(c)
+	if scheduler == nil {
+		return
+	}
+
+	GlobalServer.schedulers.setDrained(scheduler.Url, params.Drain)
+
+	log.Infof("scheduler %s %s drained: %t", scheduler.AreaId, scheduler.Url, params.Drain)
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+// ResolveSchedulerHandler resolves the ip of the scheduler host again, its cached location is dropped.
+func ResolveSchedulerHandler(c *gin.Context) {
+	_, scheduler := bindSchedulerAction(c)
+	if scheduler == nil {
+		return
+	}
+
+	ip, err := resolveSchedulerIP(scheduler.config.SchedulerURL)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	resolved := *scheduler
+	resolved.IP = ip
+
+	if !GlobalServer.schedulers.replace(scheduler, &resolved) {
+		c.JSON(http.StatusOK, respError(errors.ErrNotFound))
+		return
+	}
+
+	GlobalServer.capacity.forget(scheduler)
+
+	c.JSON(http.StatusOK, respJSON(newSchedulerInventory(&resolved, getProjectCounts(c.Request.Context()))))
+}
@@ -29,6 +29,15 @@ type loginResponse struct {
 
 var identityKey = "id"
 
+// workspaceKey holds the organization the user is working in, the personal workspace when empty.
+var workspaceKey = "workspace"
+
+// workspaceIdentity is the payload of the tokens issued when switching workspace.
+type workspaceIdentity struct {
+	Username string
+	OrgID    string
+}
+
 func jwtGinMiddleware(secretKey string) (*jwt.GinJWTMiddleware, error) {
 	return jwt.New(&jwt.GinJWTMiddleware{
 		Realm:             "User",
@@ -38,10 +47,16 @@ func jwtGinMiddleware(secretKey string) (*jwt.GinJWTMiddleware, error) {
 		IdentityKey:       identityKey,
 		SendAuthorization: true,
 		PayloadFunc: func(data interface{}) jwt.MapClaims {
-			if v, ok := data.(*model.User); ok {
+			switch v := data.(type) {
+			case *model.User:
 				return jwt.MapClaims{
 					identityKey: v.Username,
 				}
+			case *workspaceIdentity:
+				return jwt.MapClaims{
+					identityKey:  v.Username,
+					workspaceKey: v.OrgID,
+				}
 			}
 			return jwt.MapClaims{}
 		},
@@ -133,3 +148,9 @@ func loginByPassword(ctx context.Context, username, password string) (interface{
 
 	return &model.User{Uuid: user.Uuid, Username: user.Username, Role: user.Role}, nil
 }
+
+func getWorkspace(c *gin.Context) string {
+	claims := jwt.ExtractClaims(c)
+	workspace, _ := claims[workspaceKey].(string)
+	return workspace
+}
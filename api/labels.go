@@ -0,0 +1,180 @@
+package api
+
+import (
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxLabelKeyLength   = 64
+	maxLabelValueLength = 128
+)
+
+var labelKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_./-]*[A-Za-z0-9])?$`)
+
+// ProjectItem is a project along with its labels.
+type ProjectItem struct {
+	*model.Project
+	Labels map[string]string `json:"labels"`
+}
+
+func validateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if err := validateLabelKey(key); err != nil {
+			return err
+		}
+
+		if len(value) > maxLabelValueLength || strings.ContainsAny(value, ",=!") {
+			return fmt.Errorf("invalid label value: %s", value)
+		}
+	}
+
+	return nil
+}
+
+func validateLabelKey(key string) error {
+	if len(key) > maxLabelKeyLength || !labelKeyRegexp.MatchString(key) {
+		return fmt.Errorf("invalid label key: %s", key)
+	}
+	return nil
+}
+
+// parseLabelSelector parses a comma separated selector like `env=prod,team!=edge,canary`.
+func parseLabelSelector(selector string) ([]*model.LabelRequirement, error) {
+	var out []*model.LabelRequirement
+
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		req := &model.LabelRequirement{Operator: model.LabelOperatorExists, Key: term}
+
+		if idx := strings.Index(term, "!="); idx >= 0 {
+			req.Operator = model.LabelOperatorNotEquals
+			req.Key, req.Value = term[:idx], term[idx+2:]
+		} else if idx = strings.Index(term, "="); idx >= 0 {
+			req.Operator = model.LabelOperatorEquals
+			req.Key, req.Value = term[:idx], term[idx+1:]
+		}
+
+		req.Key = strings.TrimSpace(req.Key)
+		req.Value = strings.TrimSpace(req.Value)
+
+		if err := validateLabelKey(req.Key); err != nil {
+			return nil, err
+		}
+
+		out = append(out, req)
+	}
+
+	return out, nil
+}
+
+func withProjectLabels(c *gin.Context, projects []*model.Project) ([]*ProjectItem, error) {
+	var projectIds []string
+	for _, project := range projects {
+		projectIds = append(projectIds, project.ProjectID)
+	}
+
+	labels, err := dao.GetProjectLabels(c.Request.Context(), projectIds)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*ProjectItem, 0, len(projects))
+	for _, project := range projects {
+		out = append(out, &ProjectItem{Project: project, Labels: labels[project.ProjectID]})
+	}
+
+	return out, nil
+}
+
+type UpdateLabelsReq struct {
+	Selector string            `json:"selector"`
+	Set      map[string]string `json:"set"`
+	Remove   []string          `json:"remove"`
+}
+
+// UpdateProjectLabelsHandler sets and removes labels on every project of the workspace matching the selector which
+// the user may deploy, the ids of the updated projects are returned.
+func UpdateProjectLabelsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params UpdateLabelsReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	selector, err := parseLabelSelector(params.Selector)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	// an empty selector would match every project of the user.
+	if len(selector) == 0 {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, "selector is required"))
+		return
+	}
+
+	if err = validateLabels(params.Set); err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	workspace := getWorkspace(c)
+	if workspace != "" {
+		if _, err = authorizeOrg(c.Request.Context(), username, workspace, model.ProjectRoleViewer); err != nil {
+			c.JSON(http.StatusOK, respError(err))
+			return
+		}
+	}
+
+	projects, err := dao.GetProjectsBySelector(c.Request.Context(), dao.QueryOption{UserID: username, OrgID: workspace, Labels: selector})
+	if err != nil {
+		log.Errorf("get projects by selector: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	var projectIds []string
+	for _, project := range projects {
+		// the projects the user may only view are left unchanged.
+		if _, err = authorizeProject(c.Request.Context(), username, project.ProjectID, model.ProjectRoleDeployer); err != nil {
+			continue
+		}
+
+		for key, value := range params.Set {
+			if err = dao.UpsertProjectLabel(c.Request.Context(), project.ProjectID, key, value); err != nil {
+				log.Errorf("upsert project label: %v", err)
+				c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+				return
+			}
+		}
+
+		for _, key := range params.Remove {
+			if err = dao.DeleteProjectLabel(c.Request.Context(), project.ProjectID, key); err != nil {
+				log.Errorf("delete project label: %v", err)
+				c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+				return
+			}
+		}
+
+		projectIds = append(projectIds, project.ProjectID)
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"project_ids": projectIds,
+	}))
+}
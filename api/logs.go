@@ -0,0 +1,394 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/config"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"github.com/gorilla/websocket"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	LogSourceNode = "node"
+	LogSourceFake = "fake"
+)
+
+const (
+	defaultLogsLimit    = 1000
+	maxLogsLimit        = 5000
+	defaultLogsRange    = time.Hour
+	defaultTailInterval = 2 * time.Second
+	tailWriteTimeout    = 10 * time.Second
+)
+
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	NodeID  string    `json:"node_id"`
+	AreaID  string    `json:"area_id"`
+	Stream  string    `json:"stream"`
+	Message string    `json:"message"`
+}
+
+type LogQuery struct {
+	ProjectID string
+	// NodeID limits the logs to the replica running on the node, every replica when empty.
+	NodeID string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// LogSource returns the logs of the replicas of a project running in the area of a scheduler, oldest first.
+type LogSource interface {
+	GetLogs(ctx context.Context, scheduler *Scheduler, query *LogQuery) ([]*LogEntry, error)
+}
+
+func newLogSource(cfg config.LogsConfig) LogSource {
+	if cfg.Source == LogSourceFake {
+		return NewFakeLogSource()
+	}
+	return NewNodeLogSource(cfg.NodePort, cfg.NodePath)
+}
+
+type nodeLogSource struct {
+	port   int64
+	path   string
+	client *http.Client
+}
+
+// NewNodeLogSource returns a source querying the log endpoint of every node running a replica of the project.
+func NewNodeLogSource(port int64, path string) LogSource {
+	return &nodeLogSource{
+		port:   port,
+		path:   path,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *nodeLogSource) GetLogs(ctx context.Context, scheduler *Scheduler, query *LogQuery) ([]*LogEntry, error) {
+	info, err := scheduler.Api.GetProjectInfo(ctx, query.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*LogEntry
+	for _, replica := range info.DetailsList {
+		if query.NodeID != "" && replica.NodeID != query.NodeID {
+			continue
+		}
+
+		node, err := scheduler.Api.GetNodeInfo(ctx, replica.NodeID)
+		if err != nil {
+			log.Errorf("logs: get node info %s: %v", replica.NodeID, err)
+			continue
+		}
+
+		entries, err := s.getNodeLogs(ctx, node.ExternalIP, query)
+		if err != nil {
+			log.Errorf("logs: get logs from node %s: %v", replica.NodeID, err)
+			continue
+		}
+
+		for _, entry := range entries {
+			entry.NodeID = replica.NodeID
+			entry.AreaID = scheduler.AreaId
+		}
+
+		out = append(out, entries...)
+	}
+
+	return out, nil
+}
+
+func (s *nodeLogSource) getNodeLogs(ctx context.Context, ip string, query *LogQuery) ([]*LogEntry, error) {
+	values := url.Values{}
+	values.Set("project_id", query.ProjectID)
+	values.Set("since", query.Since.Format(time.RFC3339Nano))
+	values.Set("until", query.Until.Format(time.RFC3339Nano))
+	values.Set("limit", strconv.Itoa(query.Limit))
+
+	reqURL := &url.URL{
+		Scheme:   "http",
+		Host:     net.JoinHostPort(ip, strconv.FormatInt(s.port, 10)),
+		Path:     s.path,
+		RawQuery: values.Encode(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var out []*LogEntry
+	if err = json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+type fakeLogSource struct{}
+
+// NewFakeLogSource returns a source generating one entry per second of the queried range, it does not reach the
+// schedulers or the nodes.
+func NewFakeLogSource() LogSource {
+	return fakeLogSource{}
+}
+
+func (fakeLogSource) GetLogs(ctx context.Context, scheduler *Scheduler, query *LogQuery) ([]*LogEntry, error) {
+	nodeId := query.NodeID
+	if nodeId == "" {
+		nodeId = "fake-node"
+	}
+
+	var out []*LogEntry
+	for t := query.Since.Truncate(time.Second).Add(time.Second); t.Before(query.Until) && len(out) < query.Limit; t = t.Add(time.Second) {
+		out = append(out, &LogEntry{
+			Time:    t,
+			NodeID:  nodeId,
+			AreaID:  scheduler.AreaId,
+			Stream:  "stdout",
+			Message: fmt.Sprintf("project %s fake log line at %s", query.ProjectID, t.Format(time.RFC3339)),
+		})
+	}
+
+	return out, nil
+}
+
+// collectLogs gathers the logs of every area of the project, or of the given area, oldest first.
+func collectLogs(ctx context.Context, source LogSource, project *model.Project, areaId string, query *LogQuery) ([]*LogEntry, error) {
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedulers []*Scheduler
+	for _, placement := range placements {
+		if areaId != "" && placement.AreaID != areaId {
+			continue
+		}
+
+		scheduler, err := GetSchedulerByAreaId(placement.AreaID)
+		if err != nil {
+			log.Errorf("logs: %v", err)
+			continue
+		}
+
+		schedulers = append(schedulers, scheduler)
+	}
+
+	return mergeLogs(ctx, source, schedulers, query), nil
+}
+
+// mergeLogs gets the logs from every scheduler concurrently and merges them, oldest first and at most query.Limit.
+func mergeLogs(ctx context.Context, source LogSource, schedulers []*Scheduler, query *LogQuery) []*LogEntry {
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		out []*LogEntry
+	)
+
+	for _, scheduler := range schedulers {
+		wg.Add(1)
+		go func(scheduler *Scheduler) {
+			defer wg.Done()
+
+			entries, err := source.GetLogs(ctx, scheduler, query)
+			if err != nil {
+				log.Errorf("logs: get logs from %s: %v", scheduler.AreaId, err)
+				return
+			}
+
+			mu.Lock()
+			out = append(out, entries...)
+			mu.Unlock()
+		}(scheduler)
+	}
+
+	wg.Wait()
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Time.Before(out[j].Time)
+	})
+
+	if len(out) > query.Limit {
+		out = out[:query.Limit]
+	}
+
+	return out
+}
+
+func parseLogTime(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.ParseInLocation(time.DateTime, value, time.Local)
+}
+
+func parseLogQuery(c *gin.Context) (*LogQuery, error) {
+	now := time.Now()
+
+	until, err := parseLogTime(c.Query("until"), now)
+	if err != nil {
+		return nil, fmt.Errorf("invalid until: %s", c.Query("until"))
+	}
+
+	since, err := parseLogTime(c.Query("since"), until.Add(-defaultLogsRange))
+	if err != nil {
+		return nil, fmt.Errorf("invalid since: %s", c.Query("since"))
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = defaultLogsLimit
+	}
+	if limit > maxLogsLimit {
+		limit = maxLogsLimit
+	}
+
+	return &LogQuery{
+		ProjectID: c.Query("project_id"),
+		NodeID:    c.Query("node_id"),
+		Since:     since,
+		Until:     until,
+		Limit:     limit,
+	}, nil
+}
+
+// GetProjectLogsHandler returns the logs of the project between since and until, the last hour by default.
+func GetProjectLogsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	query, err := parseLogQuery(c)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	project, err := authorizeProject(c.Request.Context(), username, query.ProjectID, model.ProjectRoleViewer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	entries, err := collectLogs(c.Request.Context(), GlobalServer.logs, project, c.Query("area_id"), query)
+	if err != nil {
+		log.Errorf("collect logs: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": entries,
+	}))
+}
+
+var logsUpgrader = websocket.Upgrader{
+	// the api is served to browsers of any origin, see Cors.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// TailProjectLogsHandler upgrades to a websocket and pushes the new log entries of the project as they appear.
+func TailProjectLogsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	query, err := parseLogQuery(c)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	project, err := authorizeProject(c.Request.Context(), username, query.ProjectID, model.ProjectRoleViewer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	conn, err := logsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Errorf("logs: upgrade: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	// the client does not send anything, reading only notices when it goes away.
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	interval := GlobalServer.cfg.Logs.TailInterval
+	if interval <= 0 {
+		interval = defaultTailInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// tailing starts from now unless since is given.
+	if c.Query("since") == "" {
+		query.Since = time.Now()
+	}
+
+	areaId := c.Query("area_id")
+	for {
+		query.Until = time.Now()
+
+		entries, err := collectLogs(ctx, GlobalServer.logs, project, areaId, query)
+		if err != nil {
+			log.Errorf("logs: tail: %v", err)
+		}
+
+		for _, entry := range entries {
+			conn.SetWriteDeadline(time.Now().Add(tailWriteTimeout))
+			if err = conn.WriteJSON(entry); err != nil {
+				return
+			}
+
+			if entry.Time.After(query.Since) {
+				query.Since = entry.Time
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMergeLogsOrdersAndLimits(t *testing.T) {
+	until := time.Now()
+	query := &LogQuery{
+		ProjectID: "p1",
+		Since:     until.Add(-time.Minute),
+		Until:     until,
+		Limit:     40,
+	}
+
+	schedulers := []*Scheduler{{AreaId: "area-a"}, {AreaId: "area-b"}, {AreaId: "area-c"}}
+
+	out := mergeLogs(context.Background(), NewFakeLogSource(), schedulers, query)
+
+	if len(out) != query.Limit {
+		t.Fatalf("got %d entries, want %d", len(out), query.Limit)
+	}
+
+	areas := make(map[string]bool)
+	for i, entry := range out {
+		areas[entry.AreaID] = true
+		if i > 0 && entry.Time.Before(out[i-1].Time) {
+			t.Fatalf("entry %d at %s is before entry %d at %s", i, entry.Time, i-1, out[i-1].Time)
+		}
+		if entry.Time.Before(query.Since) || !entry.Time.Before(query.Until) {
+			t.Fatalf("entry %d at %s is out of the queried range", i, entry.Time)
+		}
+	}
+
+	// each area returns up to the limit, so the oldest entries of every area are kept.
+	if len(areas) != len(schedulers) {
+		t.Errorf("got entries from %d areas, want %d", len(areas), len(schedulers))
+	}
+}
+
+func TestMergeLogsUnderLimit(t *testing.T) {
+	until := time.Now()
+	query := &LogQuery{
+		ProjectID: "p1",
+		NodeID:    "n1",
+		Since:     until.Add(-10 * time.Second),
+		Until:     until,
+		Limit:     100,
+	}
+
+	out := mergeLogs(context.Background(), NewFakeLogSource(), []*Scheduler{{AreaId: "area-a"}, {AreaId: "area-b"}}, query)
+
+	// one entry per second of the range in every area.
+	if len(out) < 18 || len(out) > 20 {
+		t.Fatalf("got %d entries, want about 20", len(out))
+	}
+
+	for i, entry := range out {
+		if entry.NodeID != query.NodeID {
+			t.Errorf("entry %d from node %s, want %s", i, entry.NodeID, query.NodeID)
+		}
+		if i > 0 && entry.Time.Before(out[i-1].Time) {
+			t.Fatalf("entry %d at %s is before entry %d at %s", i, entry.Time, i-1, out[i-1].Time)
+		}
+	}
+}
+
+func TestMergeLogsWithoutSchedulers(t *testing.T) {
+	query := &LogQuery{Since: time.Now().Add(-time.Minute), Until: time.Now(), Limit: 10}
+
+	if out := mergeLogs(context.Background(), NewFakeLogSource(), nil, query); len(out) != 0 {
+		t.Errorf("got %d entries, want none", len(out))
+	}
+}
@@ -0,0 +1,535 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"github.com/gnasnik/titan-workerd-api/pkg/iptool"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ManifestActionNoop    = "noop"
+	ManifestActionCreate  = "create"
+	ManifestActionUpdate  = "update"
+	ManifestActionReplace = "replace"
+	ManifestActionDelete  = "delete"
+)
+
+// ProjectManifest is the declarative description of the projects of a user, projects are keyed by name.
+type ProjectManifest struct {
+	Projects []*ProjectSpec `json:"projects" yaml:"projects" toml:"projects"`
+}
+
+type ProjectSpec struct {
+	Name       string           `json:"name" yaml:"name" toml:"name"`
+	BundleUrl  string           `json:"bundle_url" yaml:"bundle_url" toml:"bundle_url"`
+	Replicas   int64            `json:"replicas" yaml:"replicas" toml:"replicas"`
+	CpuCores   int32            `json:"cpu_cores" yaml:"cpu_cores" toml:"cpu_cores"`
+	Memory     int64            `json:"memory" yaml:"memory" toml:"memory"`
+	Expiration string           `json:"expiration" yaml:"expiration" toml:"expiration"`
+	Version    int64            `json:"version" yaml:"version" toml:"version"`
+	Region     string           `json:"region" yaml:"region" toml:"region"`
+	Placement  ProjectPlacement `json:"placement" yaml:"placement" toml:"placement"`
+
+	Description string            `json:"description" yaml:"description" toml:"description"`
+	Labels      map[string]string `json:"labels" yaml:"labels" toml:"labels"`
+}
+
+type ProjectPlacement struct {
+	AreaID        string           `json:"area_id" yaml:"area_id" toml:"area_id"`
+	NodeIds       []string         `json:"node_ids" yaml:"node_ids" toml:"node_ids"`
+	ReplicaSpread map[string]int64 `json:"replica_spread" yaml:"replica_spread" toml:"replica_spread"`
+}
+
+type ManifestChange struct {
+	Action    string   `json:"action"`
+	Name      string   `json:"name"`
+	ProjectID string   `json:"project_id,omitempty"`
+	Fields    []string `json:"fields,omitempty"`
+	Error     string   `json:"error,omitempty"`
+
+	spec    *ProjectSpec
+	project *model.Project
+}
+
+func (spec *ProjectSpec) toDeployReq() *DeployReq {
+	return &DeployReq{
+		Name:       spec.Name,
+		AreaID:     spec.Placement.AreaID,
+		Region:     spec.Region,
+		BundleUrl:  spec.BundleUrl,
+		Replicas:   spec.Replicas,
+		CpuCores:   spec.CpuCores,
+		Memory:     spec.Memory,
+		Expiration: spec.Expiration,
+		NodeIds:    strings.Join(spec.Placement.NodeIds, ","),
+		Version:    spec.Version,
+
+		ReplicaSpread: spec.Placement.ReplicaSpread,
+		Description:   spec.Description,
+		Labels:        spec.Labels,
+	}
+}
+
+func parseProjectManifest(data []byte, format string) (*ProjectManifest, error) {
+	var (
+		manifest ProjectManifest
+		err      error
+	)
+
+	switch format {
+	case "", "yaml", "yml":
+		err = yaml.Unmarshal(data, &manifest)
+	case "toml":
+		err = toml.Unmarshal(data, &manifest)
+	case "json":
+		err = json.Unmarshal(data, &manifest)
+	default:
+		return nil, fmt.Errorf("unsupported manifest format: %s", format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{})
+	for _, spec := range manifest.Projects {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("project name is required")
+		}
+
+		if _, ok := names[spec.Name]; ok {
+			return nil, fmt.Errorf("duplicate project name: %s", spec.Name)
+		}
+
+		if err = spec.validate(); err != nil {
+			return nil, fmt.Errorf("project %s: %w", spec.Name, err)
+		}
+
+		names[spec.Name] = struct{}{}
+	}
+
+	return &manifest, nil
+}
+
+// validate rejects the specs which would fail to deploy, before anything of the manifest is applied.
+func (spec *ProjectSpec) validate() error {
+	if spec.BundleUrl == "" {
+		return fmt.Errorf("bundle_url is required")
+	}
+
+	if len(spec.Placement.ReplicaSpread) > 0 {
+		for areaId, replicas := range spec.Placement.ReplicaSpread {
+			if replicas <= 0 {
+				return fmt.Errorf("invalid replicas %d for area %s", replicas, areaId)
+			}
+		}
+	} else if spec.Replicas <= 0 {
+		return fmt.Errorf("invalid replicas: %d", spec.Replicas)
+	}
+
+	if spec.Expiration != "" {
+		if _, err := time.Parse(time.DateTime, spec.Expiration); err != nil {
+			return fmt.Errorf("invalid expiration: %s", spec.Expiration)
+		}
+	}
+
+	return validateLabels(spec.Labels)
+}
+
+// planManifest diffs the manifest against the projects of the workspace, projects missing from the manifest are
+// only deleted when prune is set. The changes the user is not allowed to make carry the error and are not applied.
+func planManifest(ctx context.Context, username, workspace string, manifest *ProjectManifest, prune bool) ([]*ManifestChange, error) {
+	var changes []*ManifestChange
+
+	option := dao.QueryOption{UserID: username, OrgID: workspace}
+
+	for _, spec := range manifest.Projects {
+		projects, err := dao.GetWorkspaceProjectsByName(ctx, option, spec.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(projects) > 1 {
+			return nil, fmt.Errorf("project name %s is used by %d projects", spec.Name, len(projects))
+		}
+
+		if len(projects) == 0 {
+			changes = append(changes, &ManifestChange{Action: ManifestActionCreate, Name: spec.Name, spec: spec})
+			continue
+		}
+
+		changes = append(changes, diffProjectSpec(ctx, spec, projects[0]))
+	}
+
+	if prune {
+		projects, err := dao.GetWorkspaceProjects(ctx, option)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, pruneChanges(manifest, projects)...)
+	}
+
+	for _, change := range changes {
+		if err := authorizeManifestChange(ctx, username, workspace, change); err != nil {
+			change.Error = err.Error()
+		}
+	}
+
+	return changes, nil
+}
+
+// pruneChanges returns the deletion of every project missing from the manifest.
+func pruneChanges(manifest *ProjectManifest, projects []*model.Project) []*ManifestChange {
+	var changes []*ManifestChange
+
+	for _, project := range projects {
+		found := false
+		for _, spec := range manifest.Projects {
+			if spec.Name == project.Name {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			changes = append(changes, &ManifestChange{
+				Action:    ManifestActionDelete,
+				Name:      project.Name,
+				ProjectID: project.ProjectID,
+				project:   project,
+			})
+		}
+	}
+
+	return changes
+}
+
+// authorizeManifestChange makes sure the user holds the role the single project handlers require for the change:
+// deployer to create a project in an organization or to update one, owner to delete or replace one.
+func authorizeManifestChange(ctx context.Context, username, workspace string, change *ManifestChange) error {
+	role := ""
+	switch change.Action {
+	case ManifestActionUpdate:
+		role = model.ProjectRoleDeployer
+	case ManifestActionReplace, ManifestActionDelete:
+		role = model.ProjectRoleOwner
+	}
+
+	if role != "" {
+		if _, err := authorizeProject(ctx, username, change.project.ProjectID, role); err != nil {
+			return err
+		}
+	}
+
+	if workspace != "" && (change.Action == ManifestActionCreate || change.Action == ManifestActionReplace) {
+		if _, err := authorizeOrg(ctx, username, workspace, model.ProjectRoleDeployer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func diffProjectSpec(ctx context.Context, spec *ProjectSpec, project *model.Project) *ManifestChange {
+	change := &ManifestChange{
+		Action:    ManifestActionNoop,
+		Name:      spec.Name,
+		ProjectID: project.ProjectID,
+		spec:      spec,
+		project:   project,
+	}
+
+	// fields that can not be changed by UpdateProject require the project to be redeployed.
+	if spec.Region != project.Region {
+		change.Fields = append(change.Fields, "region")
+	}
+
+	if spec.CpuCores != project.CpuCores {
+		change.Fields = append(change.Fields, "cpu_cores")
+	}
+
+	if spec.Memory != project.Memory {
+		change.Fields = append(change.Fields, "memory")
+	}
+
+	if spec.Version != project.Version {
+		change.Fields = append(change.Fields, "version")
+	}
+
+	if spec.Expiration != "" {
+		expiration, err := time.Parse(time.DateTime, spec.Expiration)
+		if err == nil && expiration.Format(time.DateTime) != project.Expiration.Format(time.DateTime) {
+			change.Fields = append(change.Fields, "expiration")
+		}
+	}
+
+	if len(spec.Placement.ReplicaSpread) == 0 && spec.Placement.AreaID != "" && spec.Placement.AreaID != project.AreaID {
+		change.Fields = append(change.Fields, "placement.area_id")
+	}
+
+	if strings.Join(spec.Placement.NodeIds, ",") != project.NodeIds {
+		change.Fields = append(change.Fields, "placement.node_ids")
+	}
+
+	if len(change.Fields) > 0 {
+		change.Action = ManifestActionReplace
+		return change
+	}
+
+	if spec.BundleUrl != project.BundleUrl {
+		change.Fields = append(change.Fields, "bundle_url")
+	}
+
+	if len(spec.Placement.ReplicaSpread) > 0 {
+		if !replicaSpreadEqual(ctx, spec.Placement.ReplicaSpread, project) {
+			change.Fields = append(change.Fields, "placement.replica_spread")
+		}
+	} else if spec.Replicas != project.Replicas {
+		change.Fields = append(change.Fields, "replicas")
+	}
+
+	if spec.Description != project.Description {
+		change.Fields = append(change.Fields, "description")
+	}
+
+	labels, err := dao.GetProjectLabels(ctx, []string{project.ProjectID})
+	if err != nil {
+		log.Errorf("plan: get project labels: %v", err)
+	} else if !labelsEqual(spec.Labels, labels[project.ProjectID]) {
+		change.Fields = append(change.Fields, "labels")
+	}
+
+	if len(change.Fields) > 0 {
+		change.Action = ManifestActionUpdate
+		return change
+	}
+
+	// the database matches the manifest, make sure the schedulers do as well.
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		log.Errorf("plan: get project placements: %v", err)
+		return change
+	}
+
+	for _, placement := range placements {
+		scheduler, err := GetSchedulerByAreaId(placement.AreaID)
+		if err != nil {
+			log.Errorf("plan: get scheduler %s: %v", placement.AreaID, err)
+			continue
+		}
+
+		projectInfo, err := scheduler.Api.GetProjectInfo(ctx, project.ProjectID)
+		if err != nil {
+			if isProjectNotFoundErr(err) {
+				change.Action = ManifestActionReplace
+				change.Fields = []string{"scheduler." + scheduler.AreaId}
+				return change
+			}
+			log.Errorf("plan: GetProjectInfo: %v", err)
+			continue
+		}
+
+		expected := *project
+		expected.Replicas = placement.Replicas
+		if diff := diffProjectInfo(&expected, projectInfo); diff != "" {
+			change.Action = ManifestActionUpdate
+			change.Fields = append(change.Fields, "scheduler."+scheduler.AreaId+"."+diff)
+		}
+	}
+
+	return change
+}
+
+func labelsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for key, value := range a {
+		if v, ok := b[key]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// replicaSpreadEqual reports whether the project already runs with the replicas of the spread.
+func replicaSpreadEqual(ctx context.Context, spread map[string]int64, project *model.Project) bool {
+	targets, err := resolveReplicaSpread(spread)
+	if err != nil {
+		return false
+	}
+
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil || len(placements) != len(targets) {
+		return false
+	}
+
+	replicas := make(map[string]int64)
+	for _, placement := range placements {
+		replicas[placement.AreaID] = placement.Replicas
+	}
+
+	for _, target := range targets {
+		if replicas[target.Scheduler.AreaId] != target.Replicas {
+			return false
+		}
+	}
+
+	return true
+}
+
+func applyManifestChange(ctx context.Context, username, workspace, clientIP string, change *ManifestChange) error {
+	if change.project != nil && change.Action != ManifestActionNoop {
+		if err := checkProjectIdle(ctx, change.project.ProjectID); err != nil {
+			return err
+		}
+	}
+
+	switch change.Action {
+	case ManifestActionCreate:
+		return createProjectFromSpec(ctx, username, workspace, clientIP, change)
+	case ManifestActionUpdate:
+		return updateProjectFromSpec(ctx, change)
+	case ManifestActionReplace:
+		// deploy the new project first so a failed deployment leaves the old one running.
+		if err := createProjectFromSpec(ctx, username, workspace, clientIP, change); err != nil {
+			return err
+		}
+		return deleteProject(ctx, change.project)
+	case ManifestActionDelete:
+		return deleteProject(ctx, change.project)
+	}
+
+	return nil
+}
+
+func updateProjectFromSpec(ctx context.Context, change *ManifestChange) error {
+	project := *change.project
+	project.BundleUrl = change.spec.BundleUrl
+	project.Description = change.spec.Description
+
+	var err error
+	if len(change.spec.Placement.ReplicaSpread) == 0 {
+		project.Replicas = change.spec.Replicas
+		err = updateProject(ctx, &project)
+	} else if err = rebalanceProject(ctx, &project, change.spec.Placement.ReplicaSpread); err == nil {
+		err = dao.UpdateProject(ctx, &project)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return dao.SetProjectLabels(ctx, project.ProjectID, change.spec.Labels)
+}
+
+func createProjectFromSpec(ctx context.Context, username, workspace, clientIP string, change *ManifestChange) error {
+	req := change.spec.toDeployReq()
+	if err := assignProjectWorkspace(ctx, username, workspace, req); err != nil {
+		return err
+	}
+
+	project, err := createProject(ctx, username, clientIP, req)
+	if err != nil {
+		return err
+	}
+
+	change.ProjectID = project.ProjectID
+	return nil
+}
+
+func bindProjectManifest(c *gin.Context) (*ProjectManifest, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseProjectManifest(body, c.Query("format"))
+}
+
+func PlanProjectManifestHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	manifest, err := bindProjectManifest(c)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	workspace := getWorkspace(c)
+	if workspace != "" {
+		if _, err = authorizeOrg(c.Request.Context(), username, workspace, model.ProjectRoleViewer); err != nil {
+			c.JSON(http.StatusOK, respError(err))
+			return
+		}
+	}
+
+	changes, err := planManifest(c.Request.Context(), username, workspace, manifest, c.Query("prune") == "true")
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"changes": changes,
+	}))
+}
+
+func ApplyProjectManifestHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	manifest, err := bindProjectManifest(c)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	workspace := getWorkspace(c)
+	if workspace != "" {
+		if _, err = authorizeOrg(c.Request.Context(), username, workspace, model.ProjectRoleViewer); err != nil {
+			c.JSON(http.StatusOK, respError(err))
+			return
+		}
+	}
+
+	changes, err := planManifest(c.Request.Context(), username, workspace, manifest, c.Query("prune") == "true")
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	clientIP := iptool.GetClientIP(c.Request)
+
+	for _, change := range changes {
+		// the change was refused when planning.
+		if change.Error != "" {
+			continue
+		}
+
+		if err := applyManifestChange(c.Request.Context(), username, workspace, clientIP, change); err != nil {
+			log.Errorf("apply manifest: %s %s: %v", change.Action, change.Name, err)
+			change.Error = err.Error()
+		}
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"changes": changes,
+	}))
+}
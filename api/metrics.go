@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// MetricsProvider returns the metrics the scale rules of the autoscaling policies are evaluated against.
+type MetricsProvider interface {
+	// GetProjectMetrics returns the current value of every metric of the project, such as cpu or requests per second.
+	GetProjectMetrics(ctx context.Context, project *model.Project) (map[string]float64, error)
+}
+
+type noopMetricsProvider struct{}
+
+func (noopMetricsProvider) GetProjectMetrics(ctx context.Context, project *model.Project) (map[string]float64, error) {
+	return nil, nil
+}
+
+type httpMetricsProvider struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPMetricsProvider returns a provider querying `<url>?project_id=<id>`, the endpoint answers a JSON object of
+// metric names to values.
+func NewHTTPMetricsProvider(metricsURL string) MetricsProvider {
+	return &httpMetricsProvider{
+		url:    metricsURL,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *httpMetricsProvider) GetProjectMetrics(ctx context.Context, project *model.Project) (map[string]float64, error) {
+	reqURL, err := url.Parse(p.url)
+	if err != nil {
+		return nil, err
+	}
+
+	query := reqURL.Query()
+	query.Set("project_id", project.ProjectID)
+	reqURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metrics provider: unexpected status %s", resp.Status)
+	}
+
+	var out map[string]float64
+	if err = json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
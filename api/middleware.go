@@ -2,8 +2,13 @@ package api
 
 import (
 	"bytes"
+	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
 	"io"
+	"net/http"
 )
 
 func Cors() gin.HandlerFunc {
@@ -31,3 +36,18 @@ func RequestLoggerMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := jwt.ExtractClaims(c)
+		username := claims[identityKey].(string)
+
+		user, err := dao.GetUserByUsername(c.Request.Context(), username)
+		if err != nil || user.Role != model.UserRoleAdmin {
+			c.AbortWithStatusJSON(http.StatusOK, respError(errors.ErrPermissionNotAllowed))
+			return
+		}
+
+		c.Next()
+	}
+}
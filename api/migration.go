@@ -0,0 +1,598 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/Filecoin-Titan/titan/api/types"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"github.com/google/uuid"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMigrationHealthTimeout = 10 * time.Minute
+
+// migrator moves the projects of the running migration jobs to their target area one step at a time, the state of
+// every project is saved after each step so a job resumes where it stopped after a restart. A project is deployed
+// to the target area, removed from the source area once healthy in the target area, and its placements are
+// updated last.
+type migrator struct {
+	interval      time.Duration
+	healthTimeout time.Duration
+
+	// mu serializes the changes of the jobs between the migrator and the handlers.
+	mu sync.Mutex
+}
+
+func newMigrator(interval, healthTimeout time.Duration) *migrator {
+	if healthTimeout <= 0 {
+		healthTimeout = defaultMigrationHealthTimeout
+	}
+
+	return &migrator{interval: interval, healthTimeout: healthTimeout}
+}
+
+func (m *migrator) run(ctx context.Context) {
+	if m.interval <= 0 {
+		log.Infof("migrator disabled")
+		return
+	}
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.advanceOnce(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *migrator) advanceOnce(ctx context.Context) {
+	jobs, err := dao.GetMigrationJobsByStatus(ctx, model.MigrationStatusRunning)
+	if err != nil {
+		log.Errorf("migration: get jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if err = m.advance(ctx, job.JobID); err != nil {
+			log.Errorf("migration: %s: %v", job.JobID, err)
+		}
+	}
+}
+
+func (m *migrator) advance(ctx context.Context, jobId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// reload the job, it may have been canceled in the meantime.
+	job, err := dao.GetMigrationJobById(ctx, jobId)
+	if err != nil {
+		return err
+	}
+
+	if job.Status != model.MigrationStatusRunning {
+		return nil
+	}
+
+	if job.ProjectID == "" {
+		drainArea(job.SourceAreaID)
+	}
+
+	tasks, err := dao.GetMigrationTasks(ctx, job.JobID)
+	if err != nil {
+		return err
+	}
+
+	var open, failed int
+	for _, task := range tasks {
+		if task.Status == model.MigrationTaskPending || task.Status == model.MigrationTaskDeployed {
+			if err = m.advanceTask(ctx, job, task); err != nil {
+				task.Status = model.MigrationTaskFailed
+				task.Message = err.Error()
+				log.Errorf("migration %s: project %s: %v", job.JobID, task.ProjectID, err)
+			}
+
+			if err = dao.UpdateMigrationTask(ctx, task); err != nil {
+				return err
+			}
+		}
+
+		switch task.Status {
+		case model.MigrationTaskPending, model.MigrationTaskDeployed:
+			open++
+		case model.MigrationTaskFailed:
+			failed++
+		}
+	}
+
+	if open > 0 {
+		return nil
+	}
+
+	job.Status = model.MigrationStatusSucceeded
+	job.Message = fmt.Sprintf("%d projects migrated", len(tasks)-failed)
+	if failed > 0 {
+		job.Status = model.MigrationStatusFailed
+		job.Message = fmt.Sprintf("%d of %d projects failed to migrate", failed, len(tasks))
+	}
+
+	if err = dao.UpdateMigrationJob(ctx, job); err != nil {
+		return err
+	}
+
+	// an area emptied by the migration stays drained until an admin puts it back through /admin/scheduler/drain.
+	if job.Status == model.MigrationStatusFailed {
+		m.undrainSourceArea(ctx, job)
+	}
+
+	return nil
+}
+
+// advanceTask runs the next step of the migration of a project, it returns an error when the migration of the
+// project failed for good.
+func (m *migrator) advanceTask(ctx context.Context, job *model.MigrationJob, task *model.MigrationTask) error {
+	project, err := dao.GetProjectById(ctx, task.ProjectID)
+	if err == sql.ErrNoRows {
+		task.Status = model.MigrationTaskSucceeded
+		task.Message = "project deleted"
+		return nil
+	}
+	if err != nil {
+		task.Message = err.Error()
+		return nil
+	}
+
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	var source, target *model.ProjectPlacement
+	for _, placement := range placements {
+		switch placement.AreaID {
+		case job.SourceAreaID:
+			source = placement
+		case job.TargetAreaID:
+			target = placement
+		}
+	}
+
+	if source == nil {
+		if target == nil {
+			return fmt.Errorf("project does not run in area %s", job.SourceAreaID)
+		}
+
+		task.Status = model.MigrationTaskSucceeded
+		task.Message = "already migrated"
+		return nil
+	}
+
+	scheduler, err := GetSchedulerByAreaId(job.TargetAreaID)
+	if err != nil {
+		return fmt.Errorf("target area %s: %w", job.TargetAreaID, err)
+	}
+
+	if task.Status == model.MigrationTaskPending {
+		task.Replicas = source.Replicas
+		if err = deployMigratingProject(ctx, scheduler, project, source, target); err != nil {
+			return err
+		}
+
+		task.Status = model.MigrationTaskDeployed
+		task.DeployedAt = time.Now()
+		task.Message = ""
+		return nil
+	}
+
+	// the replicas already running in the target area do not tell about the migrated ones.
+	expected := task.Replicas
+	if target != nil {
+		expected += target.Replicas
+	}
+
+	err = verifyReplicaCount(ctx, scheduler, project.ProjectID, expected)
+	if err == nil {
+		err = verifyProjectAreas(ctx, project, project.ProjectID, []string{job.TargetAreaID})
+	}
+
+	if err != nil {
+		if time.Since(task.DeployedAt) < m.healthTimeout {
+			task.Message = fmt.Sprintf("waiting for the target area: %v", err)
+			return nil
+		}
+
+		if rollbackErr := rollbackMigratingProject(ctx, scheduler, project, target); rollbackErr != nil {
+			err = fmt.Errorf("%v, rollback: %v", err, rollbackErr)
+		}
+
+		return fmt.Errorf("unhealthy in area %s: %w", job.TargetAreaID, err)
+	}
+
+	// the source area may be gone already, the project is cleaned up there when possible. A failed delete keeps the
+	// task open so it is tried again on the next advance, the source placement still records the replicas meanwhile.
+	if sourceScheduler, err := GetSchedulerByAreaId(job.SourceAreaID); err == nil {
+		err = sourceScheduler.Api.DeleteProject(ctx, &types.ProjectReq{UUID: project.ProjectID})
+		if err != nil && !isProjectNotFoundErr(err) {
+			log.Errorf("migration: delete project %s from %s: %v", project.ProjectID, job.SourceAreaID, err)
+			task.Message = fmt.Sprintf("delete from source area: %v, retrying", err)
+			return nil
+		}
+	} else {
+		task.Message = fmt.Sprintf("source area %s unavailable, project left there", job.SourceAreaID)
+	}
+
+	if err = moveProjectPlacement(ctx, project, placements, source, target, job.TargetAreaID); err != nil {
+		return err
+	}
+
+	notifyEvent(ctx, project.UserID, model.EventProjectDeployed, JsonObject{"project": project, "migration_id": job.JobID})
+
+	task.Status = model.MigrationTaskSucceeded
+	return nil
+}
+
+// deployMigratingProject deploys the replicas of the source placement to the target area, or adds them to the
+// replicas already running there. It can run again after a restart: the placements are only updated once the
+// project is healthy in the target area, and a project already deployed to the target area is not deployed twice.
+func deployMigratingProject(ctx context.Context, scheduler *Scheduler, project *model.Project, source, target *model.ProjectPlacement) error {
+	if target != nil {
+		return schedulerUpdate(ctx, scheduler, &types.ProjectReq{
+			UUID:      project.ProjectID,
+			Name:      project.Name,
+			BundleURL: project.BundleUrl,
+			Replicas:  target.Replicas + source.Replicas,
+		})
+	}
+
+	if info, err := scheduler.Api.GetProjectInfo(ctx, project.ProjectID); err == nil && info != nil {
+		return nil
+	}
+
+	req := newDeployProjectReq(project)
+	req.Replicas = source.Replicas
+
+	err := schedulerDeploy(ctx, scheduler, req)
+
+	return err
+}
+
+// verifyReplicaCount makes sure the scheduler runs at least the expected replicas of the project.
+func verifyReplicaCount(ctx context.Context, scheduler *Scheduler, projectId string, expected int64) error {
+	info, err := scheduler.Api.GetProjectInfo(ctx, projectId)
+	if err != nil {
+		return err
+	}
+
+	if running := int64(len(info.DetailsList)); running < expected {
+		return fmt.Errorf("%d of %d replicas running in area %s", running, expected, scheduler.AreaId)
+	}
+
+	return nil
+}
+
+// inMigration reports whether the project is being migrated, the replicas in its target area are not recorded
+// until the migration of the project succeeds.
+func inMigration(ctx context.Context, projectId string) bool {
+	_, err := dao.GetActiveMigrationTask(ctx, projectId)
+	return err == nil
+}
+
+// rollbackMigratingProject removes the replicas deployed to the target area.
+func rollbackMigratingProject(ctx context.Context, scheduler *Scheduler, project *model.Project, target *model.ProjectPlacement) error {
+	if target != nil {
+		return schedulerUpdate(ctx, scheduler, &types.ProjectReq{
+			UUID:      project.ProjectID,
+			Name:      project.Name,
+			BundleURL: project.BundleUrl,
+			Replicas:  target.Replicas,
+		})
+	}
+
+	return scheduler.Api.DeleteProject(ctx, &types.ProjectReq{UUID: project.ProjectID})
+}
+
+// moveProjectPlacement moves the replicas of the source placement to the target area in the saved placements.
+func moveProjectPlacement(ctx context.Context, project *model.Project, placements []*model.ProjectPlacement, source, target *model.ProjectPlacement, targetAreaId string) error {
+	if target == nil {
+		target = &model.ProjectPlacement{ProjectID: project.ProjectID, AreaID: targetAreaId}
+		placements = append(placements, target)
+	}
+
+	var (
+		areaIds  []string
+		replicas int64
+	)
+
+	for _, placement := range placements {
+		if placement == source {
+			continue
+		}
+
+		if placement == target {
+			placement.Replicas += source.Replicas
+		}
+
+		if err := dao.UpsertProjectPlacement(ctx, placement); err != nil {
+			return err
+		}
+
+		areaIds = append(areaIds, placement.AreaID)
+		replicas += placement.Replicas
+	}
+
+	if err := dao.DeleteProjectPlacement(ctx, project.ProjectID, source.AreaID); err != nil {
+		return err
+	}
+
+	project.AreaID = strings.Join(areaIds, ",")
+	project.Replicas = replicas
+
+	return dao.UpdateProjectAreaId(ctx, project.ProjectID, project.AreaID, project.Replicas)
+}
+
+// drainArea takes the schedulers of the area out of the selection, the drain is applied again on every advance of
+// the job since it does not survive a restart.
+func drainArea(areaId string) {
+	for _, scheduler := range GlobalServer.GetSchedulers() {
+		if scheduler.AreaId == areaId && !GlobalServer.schedulers.isDrained(scheduler.Url) {
+			GlobalServer.schedulers.setDrained(scheduler.Url, true)
+			log.Infof("scheduler %s %s drained for migration", scheduler.AreaId, scheduler.Url)
+		}
+	}
+}
+
+// undrainSourceArea puts the source area of a whole-area job back in the selection once the job stopped, unless
+// another running job is still moving the projects out of the area.
+func (m *migrator) undrainSourceArea(ctx context.Context, job *model.MigrationJob) {
+	if job.ProjectID != "" {
+		return
+	}
+
+	jobs, err := dao.GetMigrationJobsByStatus(ctx, model.MigrationStatusRunning)
+	if err != nil {
+		log.Errorf("migration: get jobs: %v", err)
+		return
+	}
+
+	for _, other := range jobs {
+		if other.ProjectID == "" && other.SourceAreaID == job.SourceAreaID {
+			return
+		}
+	}
+
+	for _, scheduler := range GlobalServer.GetSchedulers() {
+		if scheduler.AreaId == job.SourceAreaID && GlobalServer.schedulers.isDrained(scheduler.Url) {
+			GlobalServer.schedulers.setDrained(scheduler.Url, false)
+			log.Infof("scheduler %s %s undrained, migration %s is %s", scheduler.AreaId, scheduler.Url, job.JobID, job.Status)
+		}
+	}
+}
+
+type MigrationReq struct {
+	// ProjectID is the project to migrate, every project of the source area is migrated when it is empty.
+	ProjectID    string `json:"project_id"`
+	SourceAreaID string `json:"source_area_id" binding:"required"`
+	TargetAreaID string `json:"target_area_id" binding:"required"`
+}
+
+type Migration struct {
+	*model.MigrationJob
+	Tasks []*model.MigrationTask `json:"tasks"`
+}
+
+func (m *migrator) create(ctx context.Context, username string, params *MigrationReq) (*Migration, error) {
+	if params.SourceAreaID == params.TargetAreaID {
+		return nil, fmt.Errorf("source and target areas are the same")
+	}
+
+	scheduler, err := GetSchedulerByAreaId(params.TargetAreaID)
+	if err != nil {
+		return nil, fmt.Errorf("no scheduler for target area %s", params.TargetAreaID)
+	}
+
+	if GlobalServer.schedulers.isDrained(scheduler.Url) {
+		return nil, errSchedulerDrained(scheduler)
+	}
+
+	projectIds := []string{params.ProjectID}
+	if params.ProjectID == "" {
+		projectIds, err = dao.GetProjectIdsInArea(ctx, params.SourceAreaID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	job := &model.MigrationJob{
+		JobID:        uuid.NewString(),
+		ProjectID:    params.ProjectID,
+		SourceAreaID: params.SourceAreaID,
+		TargetAreaID: params.TargetAreaID,
+		Status:       model.MigrationStatusRunning,
+		CreatedBy:    username,
+	}
+
+	tasks := make([]*model.MigrationTask, 0, len(projectIds))
+	for _, projectId := range projectIds {
+		if _, err = dao.GetActiveMigrationTask(ctx, projectId); err == nil {
+			if params.ProjectID != "" {
+				return nil, fmt.Errorf("the project already has a migration in progress")
+			}
+			// the project is already moving out of the area in another job.
+			continue
+		}
+
+		// a rollout runs replicas the placements do not describe, they would be left behind.
+		if inRollout(ctx, projectId) {
+			return nil, fmt.Errorf("project %s has a rollout in progress", projectId)
+		}
+
+		tasks = append(tasks, &model.MigrationTask{
+			JobID:     job.JobID,
+			ProjectID: projectId,
+			Status:    model.MigrationTaskPending,
+		})
+	}
+
+	if params.ProjectID == "" {
+		drainArea(params.SourceAreaID)
+	}
+
+	if err = dao.AddMigrationJob(ctx, job, tasks); err != nil {
+		return nil, err
+	}
+
+	return &Migration{MigrationJob: job, Tasks: tasks}, nil
+}
+
+// resume puts the failed projects of a failed or canceled job back in the migration.
+func (m *migrator) resume(ctx context.Context, jobId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, err := dao.GetMigrationJobById(ctx, jobId)
+	if err != nil {
+		return err
+	}
+
+	if job.Status != model.MigrationStatusFailed && job.Status != model.MigrationStatusCanceled {
+		return fmt.Errorf("migration is %s", job.Status)
+	}
+
+	if err = dao.ResetFailedMigrationTasks(ctx, job.JobID); err != nil {
+		return err
+	}
+
+	job.Status = model.MigrationStatusRunning
+	job.Message = ""
+	return dao.UpdateMigrationJob(ctx, job)
+}
+
+// cancel stops the job, the projects already deployed to the target area keep running in both areas until the
+// job is resumed. The source area of a whole-area job goes back in the selection.
+func (m *migrator) cancel(ctx context.Context, jobId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, err := dao.GetMigrationJobById(ctx, jobId)
+	if err != nil {
+		return err
+	}
+
+	if job.Status != model.MigrationStatusRunning {
+		return fmt.Errorf("migration is %s", job.Status)
+	}
+
+	job.Status = model.MigrationStatusCanceled
+	if err = dao.UpdateMigrationJob(ctx, job); err != nil {
+		return err
+	}
+
+	m.undrainSourceArea(ctx, job)
+	return nil
+}
+
+// CreateMigrationHandler starts the migration of a project, or of every project of an area, to another area.
+func CreateMigrationHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params MigrationReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	if params.ProjectID != "" {
+		if _, err := dao.GetProjectById(c.Request.Context(), params.ProjectID); err != nil {
+			c.JSON(http.StatusOK, respError(errors.ErrNotFound))
+			return
+		}
+	}
+
+	migration, err := GlobalServer.migrations.create(c.Request.Context(), username, &params)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(migration))
+}
+
+func GetMigrationsHandler(c *gin.Context) {
+	page, _ := strconv.ParseInt(c.Query("page"), 10, 64)
+	size, _ := strconv.ParseInt(c.Query("size"), 10, 64)
+
+	total, jobs, err := dao.GetMigrationJobs(c.Request.Context(), dao.QueryOption{
+		Page:     int(page),
+		PageSize: int(size),
+	})
+	if err != nil {
+		log.Errorf("get migration jobs: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  jobs,
+		"total": total,
+	}))
+}
+
+// GetMigrationHandler returns the job with the progress of every project.
+func GetMigrationHandler(c *gin.Context) {
+	job, err := dao.GetMigrationJobById(c.Request.Context(), c.Query("job_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrNotFound))
+		return
+	}
+
+	tasks, err := dao.GetMigrationTasks(c.Request.Context(), job.JobID)
+	if err != nil {
+		log.Errorf("get migration tasks: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(&Migration{MigrationJob: job, Tasks: tasks}))
+}
+
+type MigrationActionReq struct {
+	JobID string `json:"job_id" binding:"required"`
+}
+
+func ResumeMigrationHandler(c *gin.Context) {
+	migrationAction(c, GlobalServer.migrations.resume)
+}
+
+func CancelMigrationHandler(c *gin.Context) {
+	migrationAction(c, GlobalServer.migrations.cancel)
+}
+
+func migrationAction(c *gin.Context, action func(ctx context.Context, jobId string) error) {
+	var params MigrationActionReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	if err := action(c.Request.Context(), params.JobID); err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"context"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/config"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+const (
+	// schedulerHealthWindow is the number of recent calls the error rate is computed on.
+	schedulerHealthWindow = 20
+
+	defaultSchedulerProbeInterval    = 15 * time.Second
+	defaultSchedulerProbeTimeout     = 5 * time.Second
+	defaultSchedulerFailureThreshold = 3
+	defaultSchedulerBreakerCooldown  = 30 * time.Second
+)
+
+// SchedulerHealth is the health of a scheduler as seen by the monitor.
+type SchedulerHealth struct {
+	Url                 string    `json:"url"`
+	AreaId              string    `json:"area_id"`
+	State               string    `json:"state"`
+	LatencyMs           int64     `json:"latency_ms"`
+	ErrorRate           float64   `json:"error_rate"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error"`
+	LastCheckedAt       time.Time `json:"last_checked_at"`
+	OpenedAt            time.Time `json:"opened_at"`
+}
+
+// circuitBreaker opens after threshold consecutive failures of a scheduler. Once the cooldown has elapsed it turns
+// half-open and lets a single trial call through: its success closes it, its failure opens it for another cooldown.
+// The other calls are refused until the outcome of the trial, or of the next probe, is recorded.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    string
+	trial    bool
+	failures int
+	openedAt time.Time
+	results  []bool
+	latency  time.Duration
+	lastErr  string
+	lastAt   time.Time
+}
+
+func (b *circuitBreaker) record(latency time.Duration, err error, threshold int, cooldown time.Duration) (changed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.latency = latency
+	b.lastAt = now
+	b.trial = false
+
+	b.results = append(b.results, err != nil)
+	if len(b.results) > schedulerHealthWindow {
+		b.results = b.results[len(b.results)-schedulerHealthWindow:]
+	}
+
+	if err != nil {
+		b.failures++
+		b.lastErr = err.Error()
+		if b.state == BreakerHalfOpen {
+			b.state = BreakerOpen
+			b.openedAt = now
+			return true
+		}
+		if b.state == BreakerOpen {
+			b.openedAt = now
+			return false
+		}
+		if b.failures >= threshold {
+			b.state = BreakerOpen
+			b.openedAt = now
+			return true
+		}
+		return false
+	}
+
+	b.failures = 0
+	b.lastErr = ""
+	if b.state == BreakerHalfOpen || (b.state == BreakerOpen && now.Sub(b.openedAt) >= cooldown) {
+		b.state = BreakerClosed
+		return true
+	}
+
+	return false
+}
+
+// allow reports whether a call may go to the scheduler, an open breaker turns half-open once the cooldown elapsed
+// and then allows one trial call at a time.
+func (b *circuitBreaker) allow(cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= cooldown {
+		b.state = BreakerHalfOpen
+		b.trial = false
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+	}
+
+	return true
+}
+
+func (b *circuitBreaker) health() *SchedulerHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var failed int
+	for _, r := range b.results {
+		if r {
+			failed++
+		}
+	}
+
+	var errorRate float64
+	if len(b.results) > 0 {
+		errorRate = float64(failed) / float64(len(b.results))
+	}
+
+	return &SchedulerHealth{
+		State:               b.state,
+		LatencyMs:           b.latency.Milliseconds(),
+		ErrorRate:           errorRate,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastErr,
+		LastCheckedAt:       b.lastAt,
+		OpenedAt:            b.openedAt,
+	}
+}
+
+// schedulerMonitor probes every scheduler periodically and keeps a circuit breaker per scheduler url, so the
+// state survives the schedulers being refreshed from etcd.
+type schedulerMonitor struct {
+	interval  time.Duration
+	timeout   time.Duration
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newSchedulerMonitor(cfg config.SchedulerHealthConfig) *schedulerMonitor {
+	m := &schedulerMonitor{
+		interval:  cfg.Interval,
+		timeout:   cfg.Timeout,
+		threshold: cfg.FailureThreshold,
+		cooldown:  cfg.Cooldown,
+		breakers:  make(map[string]*circuitBreaker),
+	}
+
+	if m.interval <= 0 {
+		m.interval = defaultSchedulerProbeInterval
+	}
+	if m.timeout <= 0 {
+		m.timeout = defaultSchedulerProbeTimeout
+	}
+	if m.threshold <= 0 {
+		m.threshold = defaultSchedulerFailureThreshold
+	}
+	if m.cooldown <= 0 {
+		m.cooldown = defaultSchedulerBreakerCooldown
+	}
+
+	return m
+}
+
+func (m *schedulerMonitor) breaker(url string) *circuitBreaker {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.breakers[url]
+	if !ok {
+		b = &circuitBreaker{state: BreakerClosed}
+		m.breakers[url] = b
+	}
+
+	return b
+}
+
+// available reports whether the scheduler has a client and its breaker lets calls through.
+func (m *schedulerMonitor) available(scheduler *Scheduler) bool {
+	if scheduler.Api == nil {
+		return false
+	}
+
+	return m.breaker(scheduler.Url).allow(m.cooldown)
+}
+
+// record feeds the outcome of a call to the scheduler into its breaker.
+func (m *schedulerMonitor) record(scheduler *Scheduler, latency time.Duration, err error) {
+	if !m.breaker(scheduler.Url).record(latency, err, m.threshold, m.cooldown) {
+		return
+	}
+
+	if err != nil {
+		log.Warnf("scheduler monitor: %s (%s) is unavailable: %v", scheduler.AreaId, scheduler.Url, err)
+		return
+	}
+
+	log.Infof("scheduler monitor: %s (%s) recovered", scheduler.AreaId, scheduler.Url)
+}
+
+// schedulerDeploy deploys the project on the scheduler, the outcome feeds its breaker and its deploy failure rate.
+func schedulerDeploy(ctx context.Context, scheduler *Scheduler, req *types.DeployProjectReq) error {
+	start := time.Now()
+	err := scheduler.Api.DeployProject(ctx, req)
+	GlobalServer.monitor.record(scheduler, time.Since(start), err)
+	GlobalServer.capacity.recordDeploy(scheduler, err)
+	return err
+}
+
+// schedulerUpdate updates the project on the scheduler, the outcome feeds its breaker.
+func schedulerUpdate(ctx context.Context, scheduler *Scheduler, req *types.ProjectReq) error {
+	start := time.Now()
+	err := scheduler.Api.UpdateProject(ctx, req)
+	GlobalServer.monitor.record(scheduler, time.Since(start), err)
+	return err
+}
+
+func (m *schedulerMonitor) health(scheduler *Scheduler) *SchedulerHealth {
+	h := m.breaker(scheduler.Url).health()
+	h.Url = scheduler.Url
+	h.AreaId = scheduler.AreaId
+	return h
+}
+
+// prune drops the breakers of the schedulers which are gone.
+func (m *schedulerMonitor) prune(schedulers []*Scheduler) {
+	urls := make(map[string]struct{})
+	for _, scheduler := range schedulers {
+		urls[scheduler.Url] = struct{}{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for url := range m.breakers {
+		if _, ok := urls[url]; !ok {
+			delete(m.breakers, url)
+		}
+	}
+}
+
+// run probes the schedulers on every interval, the probes are what bring the schedulers with an open breaker back
+// so the monitor can not be disabled.
+func (m *schedulerMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.probeAll(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *schedulerMonitor) probeAll(ctx context.Context) {
+	schedulers := GlobalServer.GetSchedulers()
+	m.prune(schedulers)
+
+	sem := make(chan struct{}, 8)
+	var wg sync.WaitGroup
+
+	for _, scheduler := range schedulers {
+		if scheduler.Api == nil {
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(scheduler *Scheduler) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			m.probe(ctx, scheduler)
+		}(scheduler)
+	}
+
+	wg.Wait()
+}
+
+func (m *schedulerMonitor) probe(ctx context.Context, scheduler *Scheduler) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err := scheduler.Api.GetCurrentRegionInfos(ctx, scheduler.AreaId)
+	m.record(scheduler, time.Since(start), err)
+}
+
+// GetSchedulerHealthHandler lists the health of every known scheduler.
+func GetSchedulerHealthHandler(c *gin.Context) {
+	schedulers := GlobalServer.GetSchedulers()
+
+	out := make([]*SchedulerHealth, 0, len(schedulers))
+	for _, scheduler := range schedulers {
+		out = append(out, GlobalServer.monitor.health(scheduler))
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].AreaId < out[j].AreaId
+	})
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  out,
+		"total": len(out),
+	}))
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerHalfOpenAllowsOneTrial(t *testing.T) {
+	const (
+		threshold = 2
+		cooldown  = time.Minute
+	)
+
+	b := &circuitBreaker{state: BreakerClosed}
+	for i := 0; i < threshold; i++ {
+		b.record(0, fmt.Errorf("unreachable"), threshold, cooldown)
+	}
+
+	if b.state != BreakerOpen || b.allow(cooldown) {
+		t.Fatalf("state = %s, want an open breaker refusing calls", b.state)
+	}
+
+	b.openedAt = time.Now().Add(-cooldown)
+
+	if !b.allow(cooldown) {
+		t.Fatalf("the trial call was refused")
+	}
+	if b.state != BreakerHalfOpen {
+		t.Fatalf("state = %s, want %s", b.state, BreakerHalfOpen)
+	}
+	if b.allow(cooldown) {
+		t.Errorf("a second call was allowed during the trial")
+	}
+
+	b.record(0, fmt.Errorf("unreachable"), threshold, cooldown)
+	if b.state != BreakerOpen || b.allow(cooldown) {
+		t.Fatalf("state = %s after a failed trial, want an open breaker refusing calls", b.state)
+	}
+
+	b.openedAt = time.Now().Add(-cooldown)
+	if !b.allow(cooldown) {
+		t.Fatalf("the trial call was refused after another cooldown")
+	}
+
+	b.record(0, nil, threshold, cooldown)
+	if b.state != BreakerClosed {
+		t.Fatalf("state = %s after a successful trial, want %s", b.state, BreakerClosed)
+	}
+	for i := 0; i < 3; i++ {
+		if !b.allow(cooldown) {
+			t.Errorf("call %d refused by a closed breaker", i)
+		}
+	}
+}
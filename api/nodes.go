@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"sync"
+	"time"
+)
+
+// nodeIndex maps node ids to the url of the scheduler owning them, it is built from the node listings of the
+// schedulers and rebuilt when the schedulers change.
+type nodeIndex struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	nodes map[string]string
+}
+
+func newNodeIndex(interval time.Duration) *nodeIndex {
+	return &nodeIndex{
+		interval: interval,
+		nodes:    make(map[string]string),
+	}
+}
+
+func (idx *nodeIndex) run(ctx context.Context) {
+	if idx.interval <= 0 {
+		log.Infof("node index refresh disabled")
+		return
+	}
+
+	ticker := time.NewTicker(idx.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			idx.rebuild(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// rebuild lists the nodes of every available scheduler, the entries of a scheduler failing to list its nodes are
+// kept and the entries of the schedulers which are gone are dropped.
+func (idx *nodeIndex) rebuild(ctx context.Context) {
+	schedulers := GlobalServer.GetAvailableSchedulers()
+
+	sem := make(chan struct{}, 8)
+	var wg sync.WaitGroup
+
+	for _, scheduler := range schedulers {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(scheduler *Scheduler) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			ctx, cancel := context.WithTimeout(ctx, GlobalServer.monitor.timeout)
+			defer cancel()
+
+			regions, err := scheduler.Api.GetCurrentRegionInfos(ctx, "")
+			if err != nil {
+				log.Errorf("node index: list regions of %s: %v", scheduler.AreaId, err)
+				return
+			}
+
+			nodes, err := listSchedulerNodes(ctx, scheduler, regions)
+			if err != nil {
+				log.Errorf("node index: list nodes of %s: %v", scheduler.AreaId, err)
+				return
+			}
+
+			idx.setSchedulerNodes(scheduler, nodes)
+		}(scheduler)
+	}
+
+	wg.Wait()
+
+	idx.prune(GlobalServer.GetSchedulers())
+}
+
+// listSchedulerNodes lists the nodes of every region of the scheduler, or of its area when it reports no region.
+// It fails when no region could be listed, so the nodes indexed for the scheduler are not dropped on an outage.
+func listSchedulerNodes(ctx context.Context, scheduler *Scheduler, regions map[string]int) ([]*types.NodeInfo, error) {
+	if len(regions) == 0 {
+		return scheduler.Api.GetNodesFromRegion(ctx, scheduler.AreaId)
+	}
+
+	var (
+		out     []*types.NodeInfo
+		lastErr error
+		listed  int
+	)
+
+	for region := range regions {
+		nodes, err := scheduler.Api.GetNodesFromRegion(ctx, region)
+		if err != nil {
+			log.Warnf("list nodes of region %s of %s: %v", region, scheduler.AreaId, err)
+			lastErr = err
+			continue
+		}
+
+		listed++
+		out = append(out, nodes...)
+	}
+
+	if listed == 0 {
+		return nil, lastErr
+	}
+
+	return out, nil
+}
+
+// setSchedulerNodes replaces the nodes indexed for the scheduler.
+func (idx *nodeIndex) setSchedulerNodes(scheduler *Scheduler, nodes []*types.NodeInfo) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for nodeId, url := range idx.nodes {
+		if url == scheduler.Url {
+			delete(idx.nodes, nodeId)
+		}
+	}
+
+	for _, node := range nodes {
+		idx.nodes[node.NodeID] = scheduler.Url
+	}
+}
+
+func (idx *nodeIndex) set(nodeId string, scheduler *Scheduler) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.nodes[nodeId] = scheduler.Url
+}
+
+func (idx *nodeIndex) prune(schedulers []*Scheduler) {
+	urls := make(map[string]struct{})
+	for _, scheduler := range schedulers {
+		urls[scheduler.Url] = struct{}{}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for nodeId, url := range idx.nodes {
+		if _, ok := urls[url]; !ok {
+			delete(idx.nodes, nodeId)
+		}
+	}
+}
+
+// lookup returns the available scheduler indexed for the node.
+func (idx *nodeIndex) lookup(nodeId string) (*Scheduler, bool) {
+	idx.mu.Lock()
+	url, ok := idx.nodes[nodeId]
+	idx.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	for _, scheduler := range GlobalServer.GetAvailableSchedulers() {
+		if scheduler.Url == url {
+			return scheduler, true
+		}
+	}
+
+	return nil, false
+}
+
+// probeSchedulerByNodeId asks every available scheduler for the node in parallel, the first to know it wins.
+func probeSchedulerByNodeId(ctx context.Context, nodeId string) (*Scheduler, error) {
+	schedulers := GlobalServer.GetAvailableSchedulers()
+	if len(schedulers) == 0 {
+		return nil, errors.ErrNoAvailableScheduler
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, GlobalServer.monitor.timeout)
+	defer cancel()
+
+	found := make(chan *Scheduler, len(schedulers))
+	var wg sync.WaitGroup
+
+	for _, scheduler := range schedulers {
+		wg.Add(1)
+		go func(scheduler *Scheduler) {
+			defer wg.Done()
+
+			start := time.Now()
+			_, err := scheduler.Api.GetNodeInfo(ctx, nodeId)
+			if err == nil {
+				GlobalServer.monitor.record(scheduler, time.Since(start), nil)
+				found <- scheduler
+				return
+			}
+
+			// an unknown node is an error too, only a timeout which is not ours tells about the scheduler itself.
+			if ctx.Err() == context.DeadlineExceeded {
+				GlobalServer.monitor.record(scheduler, time.Since(start), ctx.Err())
+			}
+		}(scheduler)
+	}
+
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	scheduler, ok := <-found
+	if !ok {
+		return nil, errors.ErrNoAvailableScheduler
+	}
+
+	return scheduler, nil
+}
@@ -0,0 +1,345 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+// authorizeOrg loads the organization and makes sure the user is a member holding at least the given role,
+// organization members use the same roles as project grants.
+func authorizeOrg(ctx context.Context, username, orgId, role string) (*model.Organization, error) {
+	org, err := dao.GetOrganizationById(ctx, orgId)
+	if err != nil {
+		return nil, errors.ErrNotFound
+	}
+
+	member, err := dao.GetOrganizationMember(ctx, orgId, username)
+	if err != nil {
+		return nil, errors.ErrNotFound
+	}
+
+	if projectRoleRank[member.Role] < projectRoleRank[role] {
+		return nil, errors.ErrPermissionNotAllowed
+	}
+
+	return org, nil
+}
+
+// checkOrgQuota makes sure one more project running the given replicas fits in the quota of the organization,
+// a zero limit means unlimited.
+func checkOrgQuota(ctx context.Context, org *model.Organization, replicas int64) error {
+	usage, err := dao.GetOrganizationUsage(ctx, org.OrgID)
+	if err != nil {
+		return err
+	}
+
+	if org.MaxProjects > 0 && usage.Projects+1 > org.MaxProjects {
+		return fmt.Errorf("organization quota exceeded: at most %d projects", org.MaxProjects)
+	}
+
+	if org.MaxReplicas > 0 && usage.Replicas+replicas > org.MaxReplicas {
+		return fmt.Errorf("organization quota exceeded: at most %d replicas", org.MaxReplicas)
+	}
+
+	return nil
+}
+
+// orgQuotaWarningRatio is the share of a quota from which users deploying in the organization are warned.
+const orgQuotaWarningRatio = 0.8
+
+// warnOrgQuota sends a quota warning to the user when the usage of the organization reaches the warning ratio of
+// its quota once the new project runs.
+func warnOrgQuota(ctx context.Context, username string, org *model.Organization, replicas int64) {
+	usage, err := dao.GetOrganizationUsage(ctx, org.OrgID)
+	if err != nil {
+		log.Errorf("get organization usage: %v", err)
+		return
+	}
+
+	projects, totalReplicas := usage.Projects+1, usage.Replicas+replicas
+
+	if (org.MaxProjects > 0 && float64(projects) >= float64(org.MaxProjects)*orgQuotaWarningRatio) ||
+		(org.MaxReplicas > 0 && float64(totalReplicas) >= float64(org.MaxReplicas)*orgQuotaWarningRatio) {
+		notifyEvent(ctx, username, model.EventQuotaWarning, JsonObject{
+			"org_id":       org.OrgID,
+			"projects":     projects,
+			"replicas":     totalReplicas,
+			"max_projects": org.MaxProjects,
+			"max_replicas": org.MaxReplicas,
+		})
+	}
+}
+
+type CreateOrgReq struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func CreateOrgHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params CreateOrgReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	org := &model.Organization{
+		OrgID:     uuid.NewString(),
+		Name:      params.Name,
+		CreatedBy: username,
+	}
+
+	err := dao.CreateOrganization(c.Request.Context(), org, &model.OrganizationMember{
+		OrgID:  org.OrgID,
+		UserID: username,
+		Role:   model.ProjectRoleOwner,
+	})
+	if err != nil {
+		log.Errorf("create organization: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(org))
+}
+
+func GetOrgsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	orgs, err := dao.GetOrganizationsByUserId(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("get organizations: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": orgs,
+	}))
+}
+
+func GetOrgMembersHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	orgId := c.Query("org_id")
+
+	if _, err := authorizeOrg(c.Request.Context(), username, orgId, model.ProjectRoleViewer); err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	members, err := dao.GetOrganizationMembers(c.Request.Context(), orgId)
+	if err != nil {
+		log.Errorf("get organization members: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": members,
+	}))
+}
+
+type OrgMemberReq struct {
+	OrgID    string `json:"org_id" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role"`
+}
+
+func AddOrgMemberHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params OrgMemberReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	if _, ok := projectRoleRank[params.Role]; !ok {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, "invalid role: "+params.Role))
+		return
+	}
+
+	if _, err := authorizeOrg(c.Request.Context(), username, params.OrgID, model.ProjectRoleOwner); err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	if _, err := dao.GetUserByUsername(c.Request.Context(), params.Username); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrUserNotFound))
+		return
+	}
+
+	err := dao.UpsertOrganizationMember(c.Request.Context(), &model.OrganizationMember{
+		OrgID:  params.OrgID,
+		UserID: params.Username,
+		Role:   params.Role,
+	})
+	if err != nil {
+		log.Errorf("upsert organization member: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+func RemoveOrgMemberHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params OrgMemberReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	// members may always leave the organization.
+	role := model.ProjectRoleOwner
+	if params.Username == username {
+		role = model.ProjectRoleViewer
+	}
+
+	if _, err := authorizeOrg(c.Request.Context(), username, params.OrgID, role); err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	member, err := dao.GetOrganizationMember(c.Request.Context(), params.OrgID, params.Username)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrNotFound))
+		return
+	}
+
+	// keep at least one owner so the organization can still be managed.
+	if member.Role == model.ProjectRoleOwner {
+		members, err := dao.GetOrganizationMembers(c.Request.Context(), params.OrgID)
+		if err != nil {
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+			return
+		}
+
+		owners := 0
+		for _, m := range members {
+			if m.Role == model.ProjectRoleOwner {
+				owners++
+			}
+		}
+
+		if owners <= 1 {
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrPermissionNotAllowed, "can not remove the last owner"))
+			return
+		}
+	}
+
+	if err = dao.DeleteOrganizationMember(c.Request.Context(), params.OrgID, params.Username); err != nil {
+		log.Errorf("delete organization member: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+func GetOrgUsageHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	orgId := c.Query("org_id")
+
+	org, err := authorizeOrg(c.Request.Context(), username, orgId, model.ProjectRoleViewer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	usage, err := dao.GetOrganizationUsage(c.Request.Context(), orgId)
+	if err != nil {
+		log.Errorf("get organization usage: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"usage":        usage,
+		"max_projects": org.MaxProjects,
+		"max_replicas": org.MaxReplicas,
+	}))
+}
+
+type OrgQuotaReq struct {
+	OrgID       string `json:"org_id" binding:"required"`
+	MaxProjects int64  `json:"max_projects"`
+	MaxReplicas int64  `json:"max_replicas"`
+}
+
+func SetOrgQuotaHandler(c *gin.Context) {
+	var params OrgQuotaReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	if _, err := dao.GetOrganizationById(c.Request.Context(), params.OrgID); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrNotFound))
+		return
+	}
+
+	err := dao.UpdateOrganizationQuota(c.Request.Context(), params.OrgID, params.MaxProjects, params.MaxReplicas)
+	if err != nil {
+		log.Errorf("update organization quota: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+type SwitchWorkspaceReq struct {
+	// OrgID is the organization to work in, empty switches back to the personal workspace.
+	OrgID string `json:"org_id"`
+}
+
+// SwitchWorkspaceHandler issues a new token carrying the workspace the user works in.
+func SwitchWorkspaceHandler(mw *jwt.GinJWTMiddleware) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := jwt.ExtractClaims(c)
+		username := claims[identityKey].(string)
+		var params SwitchWorkspaceReq
+
+		if err := c.BindJSON(&params); err != nil {
+			c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+			return
+		}
+
+		if params.OrgID != "" {
+			if _, err := authorizeOrg(c.Request.Context(), username, params.OrgID, model.ProjectRoleViewer); err != nil {
+				c.JSON(http.StatusOK, respError(err))
+				return
+			}
+		}
+
+		token, expire, err := mw.TokenGenerator(&workspaceIdentity{Username: username, OrgID: params.OrgID})
+		if err != nil {
+			log.Errorf("generate token: %v", err)
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, respJSON(loginResponse{
+			Token:  token,
+			Expire: expire.Format(time.RFC3339),
+		}))
+	}
+}
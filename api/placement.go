@@ -0,0 +1,305 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"sort"
+	"strings"
+)
+
+// replicaPlacement is the number of replicas of a project running in the area of a scheduler.
+type replicaPlacement struct {
+	Scheduler *Scheduler
+	Replicas  int64
+}
+
+// resolveReplicaSpread maps every area of the spread to the scheduler matching it best, areas resolving to the
+// same scheduler are merged.
+func resolveReplicaSpread(spread map[string]int64) ([]*replicaPlacement, error) {
+	var areaIds []string
+	for areaId := range spread {
+		areaIds = append(areaIds, areaId)
+	}
+	sort.Strings(areaIds)
+
+	var out []*replicaPlacement
+	placements := make(map[string]*replicaPlacement)
+
+	for _, areaId := range areaIds {
+		replicas := spread[areaId]
+		if replicas <= 0 {
+			return nil, fmt.Errorf("invalid replicas %d for area %s", replicas, areaId)
+		}
+
+		scheduler, err := resolveSpreadArea(areaId)
+		if err != nil {
+			return nil, err
+		}
+
+		if p, ok := placements[scheduler.AreaId]; ok {
+			p.Replicas += replicas
+			continue
+		}
+
+		p := &replicaPlacement{Scheduler: scheduler, Replicas: replicas}
+		placements[scheduler.AreaId] = p
+		out = append(out, p)
+	}
+
+	return out, nil
+}
+
+// resolveSpreadArea returns the scheduler of an area of a spread. A full area id, Continent-Country-Province-City
+// or the area of a known scheduler, must be served by its own scheduler; a shorter prefix such as Continent-Country
+// goes to the selectable scheduler sharing the longest prefix with it.
+func resolveSpreadArea(areaId string) (*Scheduler, error) {
+	exact := strings.Count(areaId, "-") >= 3
+	for _, scheduler := range GlobalServer.GetSchedulers() {
+		if scheduler.AreaId == areaId {
+			exact = true
+			break
+		}
+	}
+
+	if !exact {
+		scheduler, err := GetMaybeBestScheduler(areaId)
+		if err != nil {
+			return nil, fmt.Errorf("no available scheduler for area %s", areaId)
+		}
+		return scheduler, nil
+	}
+
+	scheduler, err := GetSchedulerByAreaId(areaId)
+	if err != nil {
+		return nil, fmt.Errorf("no available scheduler for area %s", areaId)
+	}
+
+	if GlobalServer.schedulers.isDrained(scheduler.Url) {
+		return nil, errSchedulerDrained(scheduler)
+	}
+
+	return scheduler, nil
+}
+
+func sumReplicas(placements []*replicaPlacement) int64 {
+	var total int64
+	for _, p := range placements {
+		total += p.Replicas
+	}
+	return total
+}
+
+func joinPlacementAreaIds(placements []*replicaPlacement) string {
+	var areaIds []string
+	for _, p := range placements {
+		areaIds = append(areaIds, p.Scheduler.AreaId)
+	}
+	return strings.Join(areaIds, ",")
+}
+
+// deployProjectPlacements deploys the project to every placement and saves it along with the placements. When a
+// placement fails to deploy or the project can not be saved, the placements already deployed are deleted again so
+// no replica is left running unrecorded.
+func deployProjectPlacements(ctx context.Context, project *model.Project, placements []*replicaPlacement) error {
+	for i, p := range placements {
+		req := newDeployProjectReq(project)
+		req.Replicas = p.Replicas
+
+		err := schedulerDeploy(ctx, p.Scheduler, req)
+		if err != nil {
+			log.Errorf("api: failed to deploy project: %v", err)
+			undeployPlacements(ctx, project, placements[:i])
+			return err
+		}
+
+		event := newDeployEvent(project, DeployPhaseScheduled)
+		event.AreaID = p.Scheduler.AreaId
+		publishProjectEvent(event)
+	}
+
+	if project.AreaID == "" {
+		project.AreaID = joinPlacementAreaIds(placements)
+	}
+
+	err := dao.AddProject(ctx, project)
+	if err != nil {
+		log.Errorf("add project: %v", err)
+		undeployPlacements(ctx, project, placements)
+		return err
+	}
+
+	for _, p := range placements {
+		err = dao.UpsertProjectPlacement(ctx, &model.ProjectPlacement{
+			ProjectID: project.ProjectID,
+			AreaID:    p.Scheduler.AreaId,
+			Replicas:  p.Replicas,
+		})
+		if err != nil {
+			log.Errorf("add project placement: %v", err)
+			undeployPlacements(ctx, project, placements)
+			if err := dao.DeleteProjectPlacements(ctx, project.ProjectID); err != nil {
+				log.Errorf("roll back project placements: %v", err)
+			}
+			if err := dao.DeleteProjectById(ctx, project.ProjectID); err != nil {
+				log.Errorf("roll back project: %v", err)
+			}
+			return err
+		}
+	}
+
+	notifyEvent(ctx, project.UserID, model.EventProjectCreated, JsonObject{"project": project})
+
+	publishProjectEvent(newDeployEvent(project, DeployPhaseCompleted))
+	notifyEvent(ctx, project.UserID, model.EventProjectDeployed, JsonObject{"project": project})
+
+	return nil
+}
+
+// undeployPlacements deletes the project from the schedulers of the placements.
+func undeployPlacements(ctx context.Context, project *model.Project, placements []*replicaPlacement) {
+	for _, p := range placements {
+		if err := p.Scheduler.Api.DeleteProject(ctx, &types.ProjectReq{UUID: project.ProjectID}); err != nil {
+			log.Errorf("api: roll back deploy of project %s in %s: %v", project.ProjectID, p.Scheduler.AreaId, err)
+		}
+	}
+}
+
+// getProjectPlacements returns the saved placements of the project, projects created before placements were
+// recorded run the same replicas in every area of project.AreaID.
+func getProjectPlacements(ctx context.Context, project *model.Project) ([]*model.ProjectPlacement, error) {
+	placements, err := dao.GetProjectPlacements(ctx, project.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(placements) > 0 || project.AreaID == "" {
+		return placements, nil
+	}
+
+	for _, areaId := range strings.Split(project.AreaID, ",") {
+		placements = append(placements, &model.ProjectPlacement{
+			ProjectID: project.ProjectID,
+			AreaID:    areaId,
+			Replicas:  project.Replicas,
+		})
+	}
+
+	return placements, nil
+}
+
+// rebalanceProject moves the project to the given replica spread: areas already running the project are updated,
+// new areas get a fresh deployment and areas left out of the spread are cleaned up. When a target fails, the targets
+// already applied are put back; an area which can not be cleaned up keeps its placement so its replicas stay
+// recorded.
+func rebalanceProject(ctx context.Context, project *model.Project, spread map[string]int64) error {
+	targets, err := resolveReplicaSpread(spread)
+	if err != nil {
+		return err
+	}
+
+	current, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]*model.ProjectPlacement)
+	for _, p := range current {
+		existing[p.AreaID] = p
+	}
+
+	for i, target := range targets {
+		if _, ok := existing[target.Scheduler.AreaId]; ok {
+			err = schedulerUpdate(ctx, target.Scheduler, &types.ProjectReq{
+				UUID:      project.ProjectID,
+				Name:      project.Name,
+				BundleURL: project.BundleUrl,
+				Replicas:  target.Replicas,
+			})
+		} else {
+			req := newDeployProjectReq(project)
+			req.Replicas = target.Replicas
+			err = schedulerDeploy(ctx, target.Scheduler, req)
+		}
+
+		if err != nil {
+			log.Errorf("api: rebalance project %s to %s: %v", project.ProjectID, target.Scheduler.AreaId, err)
+			undoRebalance(ctx, project, targets[:i], existing)
+			return err
+		}
+	}
+
+	for _, target := range targets {
+		err = dao.UpsertProjectPlacement(ctx, &model.ProjectPlacement{
+			ProjectID: project.ProjectID,
+			AreaID:    target.Scheduler.AreaId,
+			Replicas:  target.Replicas,
+		})
+		if err != nil {
+			return err
+		}
+		delete(existing, target.Scheduler.AreaId)
+	}
+
+	var (
+		areaIds  = strings.Split(joinPlacementAreaIds(targets), ",")
+		replicas = sumReplicas(targets)
+		errs     []string
+	)
+
+	for areaId, placement := range existing {
+		scheduler, err := GetSchedulerByAreaId(areaId)
+		if err == nil {
+			err = scheduler.Api.DeleteProject(ctx, &types.ProjectReq{UUID: project.ProjectID})
+		}
+
+		if err != nil && !isProjectNotFoundErr(err) {
+			log.Errorf("api: rebalance project %s, delete from %s: %v", project.ProjectID, areaId, err)
+			errs = append(errs, fmt.Sprintf("delete from %s: %v", areaId, err))
+			areaIds = append(areaIds, areaId)
+			replicas += placement.Replicas
+			continue
+		}
+
+		if err = dao.DeleteProjectPlacement(ctx, project.ProjectID, areaId); err != nil {
+			return err
+		}
+	}
+
+	project.AreaID = strings.Join(areaIds, ",")
+	project.Replicas = replicas
+
+	if err = dao.UpdateProjectAreaId(ctx, project.ProjectID, project.AreaID, project.Replicas); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// undoRebalance puts the applied targets back as they were: the areas which already ran the project get their
+// previous replicas and the new areas are deleted.
+func undoRebalance(ctx context.Context, project *model.Project, applied []*replicaPlacement, existing map[string]*model.ProjectPlacement) {
+	for _, target := range applied {
+		var err error
+		if previous, ok := existing[target.Scheduler.AreaId]; ok {
+			err = schedulerUpdate(ctx, target.Scheduler, &types.ProjectReq{
+				UUID:      project.ProjectID,
+				Name:      project.Name,
+				BundleURL: project.BundleUrl,
+				Replicas:  previous.Replicas,
+			})
+		} else {
+			err = target.Scheduler.Api.DeleteProject(ctx, &types.ProjectReq{UUID: project.ProjectID})
+		}
+
+		if err != nil {
+			log.Errorf("api: roll back rebalance of project %s in %s: %v", project.ProjectID, target.Scheduler.AreaId, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/pkg/iptool"
+	"net/http"
+)
+
+type PreviewScheduler struct {
+	AreaId   string         `json:"area_id"`
+	Url      string         `json:"url"`
+	NodeIds  []string       `json:"node_ids,omitempty"`
+	Replicas int64          `json:"replicas"`
+	Regions  map[string]int `json:"regions"`
+	// AvailableNodes is the sum of the nodes of every region of the scheduler.
+	AvailableNodes int    `json:"available_nodes"`
+	Error          string `json:"error,omitempty"`
+}
+
+type PlacementPreview struct {
+	Strategy        string              `json:"strategy"`
+	Selector        string              `json:"selector,omitempty"`
+	ClientIP        string              `json:"client_ip"`
+	Schedulers      []*PreviewScheduler `json:"schedulers"`
+	UnresolvedNodes []string            `json:"unresolved_nodes,omitempty"`
+	// Scores is the scoring breakdown of the available schedulers, given for the nearest strategy.
+	Scores []*SchedulerScore `json:"scores,omitempty"`
+}
+
+// PreviewProjectHandler runs the scheduler selection of DeployProjectHandler without deploying anything.
+func PreviewProjectHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params DeployReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	clientIP := iptool.GetClientIP(c.Request)
+
+	var (
+		p        *placement
+		replicas = make(map[*Scheduler]int64)
+		err      error
+	)
+
+	if len(params.ReplicaSpread) > 0 {
+		placements, err := resolveReplicaSpread(params.ReplicaSpread)
+		if err != nil {
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+			return
+		}
+
+		p = &placement{Strategy: PlacementSpread}
+		for _, rp := range placements {
+			p.Schedulers = append(p.Schedulers, rp.Scheduler)
+			replicas[rp.Scheduler] = rp.Replicas
+		}
+	} else {
+		p, err = resolvePlacement(c.Request.Context(), username, clientIP, &params)
+		if err != nil {
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+			return
+		}
+
+		for _, scheduler := range p.Schedulers {
+			replicas[scheduler] = params.Replicas
+		}
+	}
+
+	preview := &PlacementPreview{
+		Strategy:        p.Strategy,
+		Selector:        p.Selector,
+		ClientIP:        clientIP,
+		UnresolvedNodes: p.UnresolvedNodes,
+	}
+
+	if p.Strategy == PlacementNearest {
+		preview.Scores = GlobalServer.capacity.scoreSchedulers(c.Request.Context(), GlobalServer.GetSelectableSchedulers(), &SelectRequest{
+			ClientIP: clientIP,
+			Region:   params.Region,
+		})
+	}
+
+	previews := make(map[*Scheduler]*PreviewScheduler)
+	for _, scheduler := range p.Schedulers {
+		if _, ok := previews[scheduler]; ok {
+			continue
+		}
+
+		ps := &PreviewScheduler{
+			AreaId:   scheduler.AreaId,
+			Url:      scheduler.Url,
+			Replicas: replicas[scheduler],
+		}
+
+		regions, err := scheduler.Api.GetCurrentRegionInfos(c.Request.Context(), params.Region)
+		if err != nil {
+			log.Errorf("api: GetCurrentRegionInfos: %v", err)
+			ps.Error = err.Error()
+		}
+
+		ps.Regions = regions
+		for _, count := range regions {
+			ps.AvailableNodes += count
+		}
+
+		previews[scheduler] = ps
+		preview.Schedulers = append(preview.Schedulers, ps)
+	}
+
+	for nodeId, scheduler := range p.NodeSchedulers {
+		previews[scheduler].NodeIds = append(previews[scheduler].NodeIds, nodeId)
+	}
+
+	c.JSON(http.StatusOK, respJSON(preview))
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"github.com/Filecoin-Titan/titan/api/types"
 	jwt "github.com/appleboy/gin-jwt/v2"
@@ -28,6 +29,24 @@ type DeployReq struct {
 	Expiration string `db:"expiration" json:"expiration"`
 	NodeIds    string `db:"node_ids" json:"node_ids"`
 	Version    int64  `db:"version" json:"version"`
+	// ReplicaSpread is the number of replicas per area, it takes precedence over AreaID, NodeIds and Replicas.
+	ReplicaSpread map[string]int64  `db:"-" json:"replica_spread"`
+	Description   string            `db:"description" json:"description"`
+	Labels        map[string]string `db:"-" json:"labels"`
+	// OrgID is the organization owning the project, it is taken from the workspace of the user.
+	OrgID string `db:"org_id" json:"-"`
+	// TemplateID fills the fields left empty from a template of the user or a published template.
+	TemplateID string `db:"-" json:"template_id"`
+	// Selector is a comma separated scheduler selector chain, see config.SelectorConfig, it overrides the chain
+	// configured for the user when no area or nodes are given.
+	Selector string `db:"-" json:"selector"`
+}
+
+type UpdateReq struct {
+	model.Project
+	ReplicaSpread map[string]int64 `json:"replica_spread"`
+	// Labels replace the labels of the project, they are left unchanged when nil.
+	Labels map[string]string `json:"labels"`
 }
 
 func DeployProjectHandler(c *gin.Context) {
@@ -40,89 +59,219 @@ func DeployProjectHandler(c *gin.Context) {
 		return
 	}
 
-	var (
-		schedulers []*Scheduler
-	)
+	if err := validateLabels(params.Labels); err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	if params.TemplateID != "" {
+		if err := applyProjectTemplate(c.Request.Context(), username, &params); err != nil {
+			c.JSON(http.StatusOK, respError(err))
+			return
+		}
+	}
+
+	if resp := setProjectWorkspace(c, username, &params); resp != nil {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
 
 	clientIP := iptool.GetClientIP(c.Request)
 
-	if params.AreaID == "" && params.NodeIds == "" {
-		s, err := GetNearestScheduler(c.Request.Context(), clientIP)
-		if err != nil {
-			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+	_, err := createProject(c.Request.Context(), username, clientIP, &params)
+	if err != nil {
+		if err == errors.ErrNoAvailableScheduler {
+			c.JSON(http.StatusOK, respError(err))
 			return
 		}
-		schedulers = append(schedulers, s)
-	} else if params.NodeIds != "" {
-		nodes := strings.Split(params.NodeIds, ",")
-		for _, id := range nodes {
-			s, err := GetSchedulerByNodeId(id)
-			if err != nil {
-				log.Errorf("get scheduler by node id: %s %v", id, err)
-				continue
-			}
-			schedulers = append(schedulers, s)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+// setProjectWorkspace assigns a new project to the organization of the workspace the user works in, making sure the
+// user may deploy there and the quota of the organization is not exceeded. It returns the error response if any.
+func setProjectWorkspace(c *gin.Context, username string, params *DeployReq) gin.H {
+	err := assignProjectWorkspace(c.Request.Context(), username, getWorkspace(c), params)
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := err.(errors.ApiError); ok {
+		return respError(err)
+	}
+
+	return respErrorWrapMessage(errors.ErrPermissionNotAllowed, err.Error())
+}
+
+// assignProjectWorkspace is setProjectWorkspace for the given workspace, the personal workspace when empty. It
+// returns an api error when the user may not deploy in the organization and the quota error otherwise.
+func assignProjectWorkspace(ctx context.Context, username, workspace string, params *DeployReq) error {
+	if workspace == "" {
+		return nil
+	}
+
+	org, err := authorizeOrg(ctx, username, workspace, model.ProjectRoleDeployer)
+	if err != nil {
+		return err
+	}
+
+	replicas := params.Replicas
+	if len(params.ReplicaSpread) > 0 {
+		replicas = 0
+		for _, r := range params.ReplicaSpread {
+			replicas += r
 		}
+	}
 
-	} else if params.AreaID != "" {
-		s, err := GetSchedulerByAreaId(params.AreaID)
+	if err = checkOrgQuota(ctx, org, replicas); err != nil {
+		return err
+	}
+
+	warnOrgQuota(ctx, username, org, replicas)
+
+	params.OrgID = workspace
+	return nil
+}
+
+// createProject selects the schedulers for the request, deploys the project to them and saves it with its labels.
+func createProject(ctx context.Context, username, clientIP string, params *DeployReq) (_ *model.Project, err error) {
+	project := newProjectFromDeployReq(username, params)
+
+	publishProjectEvent(newDeployEvent(project, DeployPhaseStarted))
+
+	defer func() {
 		if err != nil {
-			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
-			return
+			event := newDeployEvent(project, DeployPhaseFailed)
+			event.Error = err.Error()
+			publishProjectEvent(event)
+
+			notifyEvent(ctx, username, model.EventProjectFailed, JsonObject{"project": project, "error": err.Error()})
+		}
+	}()
+
+	if len(params.ReplicaSpread) > 0 {
+		placements, err := resolveReplicaSpread(params.ReplicaSpread)
+		if err != nil {
+			return nil, err
+		}
+
+		project.AreaID = joinPlacementAreaIds(placements)
+		project.Replicas = sumReplicas(placements)
+
+		if err = deployProjectPlacements(ctx, project, placements); err != nil {
+			return nil, err
 		}
-		schedulers = append(schedulers, s)
 	} else {
-		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
-		return
-	}
+		schedulers, err := getDeploySchedulers(ctx, username, clientIP, params)
+		if err != nil {
+			return nil, err
+		}
 
-	if len(schedulers) == 0 {
-		c.JSON(http.StatusOK, respError(errors.ErrNoAvailableScheduler))
-		return
+		if len(schedulers) == 0 {
+			return nil, errors.ErrNoAvailableScheduler
+		}
+
+		if err = deployProject(ctx, project, schedulers); err != nil {
+			return nil, err
+		}
 	}
 
-	projectId := uuid.NewString()
-	expirationT, _ := time.Parse(time.DateTime, params.Expiration)
-	if expirationT.IsZero() {
-		expirationT = time.Now().AddDate(1, 0, 0)
+	if len(params.Labels) > 0 {
+		if err := dao.SetProjectLabels(ctx, project.ProjectID, params.Labels); err != nil {
+			log.Errorf("set project labels: %v", err)
+			return nil, err
+		}
 	}
 
-	var areaIds []string
+	return project, nil
+}
 
-	for _, scheduler := range schedulers {
-		areaIds = append(areaIds, scheduler.AreaId)
-		var nodeIds []string
-		if params.NodeIds != "" {
-			nodeIds = strings.Split(params.NodeIds, ",")
-		}
-		err := scheduler.Api.DeployProject(c.Request.Context(), &types.DeployProjectReq{
-			UUID:      projectId,
-			Name:      params.Name,
-			BundleURL: params.BundleUrl,
-			UserID:    username,
-			Replicas:  params.Replicas,
-			Requirement: types.ProjectRequirement{
-				CPUCores: int64(params.CpuCores),
-				Memory:   params.Memory,
-				AreaID:   params.Region,
-				NodeIDs:  nodeIds,
-				Version:  params.Version,
-			},
-			Expiration: expirationT,
+const (
+	PlacementNearest = "nearest"
+	PlacementNodes   = "nodes"
+	PlacementArea    = "area"
+	PlacementSpread  = "spread"
+)
+
+type placement struct {
+	Strategy string
+	// Selector is the selector of the chain which picked the scheduler with the nearest strategy.
+	Selector   string
+	Schedulers []*Scheduler
+	// NodeSchedulers maps the requested node ids to the scheduler owning them.
+	NodeSchedulers  map[string]*Scheduler
+	UnresolvedNodes []string
+}
+
+// resolvePlacement selects the schedulers a new project should be deployed to: the schedulers owning the given nodes,
+// the scheduler of the given area, or the scheduler picked by the selector chain of the request or the user. It has
+// no side effects.
+func resolvePlacement(ctx context.Context, username, clientIP string, params *DeployReq) (*placement, error) {
+	p := &placement{NodeSchedulers: make(map[string]*Scheduler)}
+	areaId, nodeIds := params.AreaID, params.NodeIds
+
+	if areaId == "" && nodeIds == "" {
+		p.Strategy = PlacementNearest
+		s, selector, err := selectScheduler(ctx, username, params.Selector, &SelectRequest{
+			ClientIP: clientIP,
+			Region:   params.Region,
 		})
 		if err != nil {
-			log.Errorf("api: failed to deploy project: %v", err)
-			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
-			return
+			return nil, err
 		}
+		p.Selector = selector
+		p.Schedulers = append(p.Schedulers, s)
+	} else if nodeIds != "" {
+		p.Strategy = PlacementNodes
+		nodes := strings.Split(nodeIds, ",")
+		for _, id := range nodes {
+			s, err := GetSchedulerByNodeId(ctx, id)
+			if err == nil && GlobalServer.schedulers.isDrained(s.Url) {
+				err = errSchedulerDrained(s)
+			}
+			if err != nil {
+				log.Errorf("get scheduler by node id: %s %v", id, err)
+				p.UnresolvedNodes = append(p.UnresolvedNodes, id)
+				continue
+			}
+			p.Schedulers = append(p.Schedulers, s)
+			p.NodeSchedulers[id] = s
+		}
+	} else {
+		p.Strategy = PlacementArea
+		s, err := GetSchedulerByAreaId(areaId)
+		if err != nil {
+			return nil, err
+		}
+		if GlobalServer.schedulers.isDrained(s.Url) {
+			return nil, errSchedulerDrained(s)
+		}
+		p.Schedulers = append(p.Schedulers, s)
 	}
 
-	if params.AreaID == "" {
-		params.AreaID = strings.Join(areaIds, ",")
+	return p, nil
+}
+
+func getDeploySchedulers(ctx context.Context, username, clientIP string, params *DeployReq) ([]*Scheduler, error) {
+	p, err := resolvePlacement(ctx, username, clientIP, params)
+	if err != nil {
+		return nil, err
 	}
 
-	err := dao.AddProject(c.Request.Context(), &model.Project{
-		ProjectID:  projectId,
+	return p.Schedulers, nil
+}
+
+func newProjectFromDeployReq(username string, params *DeployReq) *model.Project {
+	expirationT, _ := time.Parse(time.DateTime, params.Expiration)
+	if expirationT.IsZero() {
+		expirationT = time.Now().AddDate(1, 0, 0)
+	}
+
+	return &model.Project{
+		ProjectID:  uuid.NewString(),
 		UserID:     username,
 		Name:       params.Name,
 		AreaID:     params.AreaID,
@@ -134,14 +283,50 @@ func DeployProjectHandler(c *gin.Context) {
 		Expiration: expirationT,
 		NodeIds:    params.NodeIds,
 		Version:    params.Version,
-	})
-	if err != nil {
-		log.Errorf("add project: %v", err)
-		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
-		return
+
+		Description: params.Description,
+		OrgID:       params.OrgID,
 	}
+}
 
-	c.JSON(http.StatusOK, respJSON(nil))
+// deployProject deploys the project with the same replicas to every scheduler and saves it.
+func deployProject(ctx context.Context, project *model.Project, schedulers []*Scheduler) error {
+	var placements []*replicaPlacement
+
+	deployed := make(map[*Scheduler]struct{})
+	for _, scheduler := range schedulers {
+		if _, ok := deployed[scheduler]; ok {
+			continue
+		}
+		deployed[scheduler] = struct{}{}
+
+		placements = append(placements, &replicaPlacement{Scheduler: scheduler, Replicas: project.Replicas})
+	}
+
+	return deployProjectPlacements(ctx, project, placements)
+}
+
+func newDeployProjectReq(project *model.Project) *types.DeployProjectReq {
+	var nodeIds []string
+	if project.NodeIds != "" {
+		nodeIds = strings.Split(project.NodeIds, ",")
+	}
+
+	return &types.DeployProjectReq{
+		UUID:      project.ProjectID,
+		Name:      project.Name,
+		BundleURL: project.BundleUrl,
+		UserID:    project.UserID,
+		Replicas:  project.Replicas,
+		Requirement: types.ProjectRequirement{
+			CPUCores: int64(project.CpuCores),
+			Memory:   project.Memory,
+			AreaID:   project.Region,
+			NodeIDs:  nodeIds,
+			Version:  project.Version,
+		},
+		Expiration: project.Expiration,
+	}
 }
 
 func GetProjectsHandler(c *gin.Context) {
@@ -150,10 +335,27 @@ func GetProjectsHandler(c *gin.Context) {
 
 	page, _ := strconv.ParseInt(c.Query("page"), 10, 64)
 	size, _ := strconv.ParseInt(c.Query("size"), 10, 64)
+
+	selector, err := parseLabelSelector(c.Query("selector"))
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	workspace := getWorkspace(c)
+	if workspace != "" {
+		if _, err = authorizeOrg(c.Request.Context(), username, workspace, model.ProjectRoleViewer); err != nil {
+			c.JSON(http.StatusOK, respError(err))
+			return
+		}
+	}
+
 	option := dao.QueryOption{
 		Page:     int(page),
 		PageSize: int(size),
 		UserID:   username,
+		OrgID:    workspace,
+		Labels:   selector,
 	}
 
 	total, projects, err := dao.GetProjectByUserId(c.Request.Context(), option)
@@ -179,8 +381,15 @@ func GetProjectsHandler(c *gin.Context) {
 		project.Status = projectInfo.State
 	}
 
+	list, err := withProjectLabels(c, projects)
+	if err != nil {
+		log.Errorf("failed to get project labels: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
 	c.JSON(http.StatusOK, respJSON(JsonObject{
-		"list":  projects,
+		"list":  list,
 		"total": total,
 	}))
 }
@@ -190,14 +399,9 @@ func GetProjectInfoHandler(c *gin.Context) {
 	username := claims[identityKey].(string)
 	projectId := c.Query("project_id")
 
-	project, err := dao.GetProjectById(c.Request.Context(), projectId)
+	project, err := authorizeProject(c.Request.Context(), username, projectId, model.ProjectRoleViewer)
 	if err != nil {
-		c.JSON(http.StatusOK, respError(errors.ErrProjectNotExists))
-		return
-	}
-
-	if project.UserID != username {
-		c.JSON(http.StatusOK, respError(errors.ErrProjectNotExists))
+		c.JSON(http.StatusOK, respError(err))
 		return
 	}
 
@@ -229,14 +433,9 @@ func GetProjectTunnelsHandler(c *gin.Context) {
 	username := claims[identityKey].(string)
 	projectId := c.Query("project_id")
 
-	project, err := dao.GetProjectById(c.Request.Context(), projectId)
+	project, err := authorizeProject(c.Request.Context(), username, projectId, model.ProjectRoleViewer)
 	if err != nil {
-		c.JSON(http.StatusOK, respError(errors.ErrProjectNotExists))
-		return
-	}
-
-	if project.UserID != username {
-		c.JSON(http.StatusOK, respError(errors.ErrProjectNotExists))
+		c.JSON(http.StatusOK, respError(err))
 		return
 	}
 
@@ -302,21 +501,28 @@ func GetAreaIdFromLocation(l *model.Location) string {
 func UpdateProjectHandler(c *gin.Context) {
 	claims := jwt.ExtractClaims(c)
 	username := claims[identityKey].(string)
-	var params model.Project
+	var req UpdateReq
 
-	if err := c.BindJSON(&params); err != nil {
+	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
 		return
 	}
 
-	project, err := dao.GetProjectById(c.Request.Context(), params.ProjectID)
+	params := req.Project
+
+	if err := validateLabels(req.Labels); err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	project, err := authorizeProject(c.Request.Context(), username, params.ProjectID, model.ProjectRoleDeployer)
 	if err != nil {
-		c.JSON(http.StatusOK, respError(errors.ErrProjectNotExists))
+		c.JSON(http.StatusOK, respError(err))
 		return
 	}
 
-	if project.UserID != username {
-		c.JSON(http.StatusOK, respError(errors.ErrProjectNotExists))
+	if err = checkProjectIdle(c.Request.Context(), project.ProjectID); err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
 		return
 	}
 
@@ -332,36 +538,57 @@ func UpdateProjectHandler(c *gin.Context) {
 		params.Replicas = project.Replicas
 	}
 
-	var (
-		scheduler *Scheduler
-	)
+	if params.Description == "" {
+		params.Description = project.Description
+	}
 
-	if params.AreaID == "" {
-		scheduler, err = GetRandomSchedulerAPI()
-	} else {
-		scheduler, err = GetSchedulerByAreaId(params.AreaID)
+	if req.Labels != nil {
+		if err = dao.SetProjectLabels(c.Request.Context(), project.ProjectID, req.Labels); err != nil {
+			log.Errorf("set project labels: %v", err)
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+			return
+		}
 	}
 
-	if err != nil {
-		c.JSON(http.StatusOK, respError(err))
+	if len(req.ReplicaSpread) > 0 {
+		project.Name = params.Name
+		project.BundleUrl = params.BundleUrl
+		project.Description = params.Description
+
+		if err = rebalanceProject(c.Request.Context(), project, req.ReplicaSpread); err != nil {
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+			return
+		}
+
+		if err = dao.UpdateProject(c.Request.Context(), project); err != nil {
+			log.Errorf("update project: %v", err)
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, respJSON(nil))
 		return
 	}
 
-	err = scheduler.Api.UpdateProject(c.Request.Context(), &types.ProjectReq{
-		UUID:      project.ProjectID,
-		Name:      params.Name,
-		BundleURL: params.BundleUrl,
-		Replicas:  params.Replicas,
-	})
+	placements, err := getProjectPlacements(c.Request.Context(), project)
 	if err != nil {
-		log.Errorf("api: failed to deploy project: %v", err)
+		log.Errorf("get project placements: %v", err)
 		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
 		return
 	}
 
-	err = dao.UpdateProject(c.Request.Context(), &params)
-	if err != nil {
-		log.Errorf("update project: %v", err)
+	// the replicas of a project spread over several areas are changed through its replica spread.
+	if len(placements) > 1 && params.Replicas != project.Replicas {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, "replica_spread is required to change the replicas of a project in several areas"))
+		return
+	}
+
+	project.Name = params.Name
+	project.BundleUrl = params.BundleUrl
+	project.Replicas = params.Replicas
+	project.Description = params.Description
+
+	if err = updateProject(c.Request.Context(), project); err != nil {
 		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
 		return
 	}
@@ -374,50 +601,174 @@ func DeleteProjectHandler(c *gin.Context) {
 	username := claims[identityKey].(string)
 	projectId := c.Query("project_id")
 
-	project, err := dao.GetProjectById(c.Request.Context(), projectId)
+	project, err := authorizeProject(c.Request.Context(), username, projectId, model.ProjectRoleOwner)
 	if err != nil {
-		c.JSON(http.StatusOK, respError(errors.ErrProjectNotExists))
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	// the replicas of a running rollout or migration are not all recorded, they are cleaned up by aborting it.
+	if err = checkProjectIdle(c.Request.Context(), project.ProjectID); err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
 		return
 	}
 
-	if project.UserID != username {
-		c.JSON(http.StatusOK, respError(errors.ErrProjectNotExists))
+	err = deleteProject(c.Request.Context(), project)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
 		return
 	}
 
-	var (
-		scheduler *Scheduler
-	)
+	c.JSON(http.StatusOK, respJSON(nil))
+}
 
+// getProjectSchedulers returns the schedulers of every area the project is deployed to.
+func getProjectSchedulers(project *model.Project) ([]*Scheduler, error) {
 	if project.AreaID == "" {
-		scheduler, err = GetRandomSchedulerAPI()
-	} else {
-		scheduler, err = GetSchedulerByAreaId(project.AreaID)
+		scheduler, err := GetRandomSchedulerAPI()
+		if err != nil {
+			return nil, err
+		}
+		return []*Scheduler{scheduler}, nil
 	}
 
-	if err != nil {
-		c.JSON(http.StatusOK, respError(err))
-		return
+	var schedulers []*Scheduler
+	for _, areaId := range strings.Split(project.AreaID, ",") {
+		scheduler, err := GetSchedulerByAreaId(areaId)
+		if err != nil {
+			return nil, err
+		}
+		schedulers = append(schedulers, scheduler)
 	}
 
-	err = scheduler.Api.DeleteProject(c.Request.Context(), &types.ProjectReq{UUID: projectId})
+	return schedulers, nil
+}
+
+// deleteProject removes the project from its schedulers and deletes it, failures from the schedulers are only logged.
+func deleteProject(ctx context.Context, project *model.Project) error {
+	schedulers, err := getProjectSchedulers(project)
 	if err != nil {
-		log.Errorf("api: failed to delete project: %v", err)
+		return err
 	}
 
-	err = dao.DeleteProjectById(c.Request.Context(), projectId)
+	for _, scheduler := range schedulers {
+		err = scheduler.Api.DeleteProject(ctx, &types.ProjectReq{UUID: project.ProjectID})
+		if err != nil {
+			log.Errorf("api: failed to delete project: %v", err)
+		}
+	}
+
+	err = dao.DeleteProjectById(ctx, project.ProjectID)
 	if err != nil {
 		log.Errorf("failed to delete project: %v", err)
-		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
-		return
+		return err
 	}
 
-	c.JSON(http.StatusOK, respJSON(nil))
+	err = dao.DeleteProjectPlacements(ctx, project.ProjectID)
+	if err != nil {
+		log.Errorf("failed to delete project placements: %v", err)
+		return err
+	}
+
+	err = dao.DeleteProjectLabels(ctx, project.ProjectID)
+	if err != nil {
+		log.Errorf("failed to delete project labels: %v", err)
+		return err
+	}
+
+	err = dao.DeleteProjectGrants(ctx, project.ProjectID)
+	if err != nil {
+		log.Errorf("failed to delete project grants: %v", err)
+		return err
+	}
+
+	err = dao.DeleteAutoscalePolicy(ctx, project.ProjectID)
+	if err != nil {
+		log.Errorf("failed to delete autoscale policy: %v", err)
+		return err
+	}
+
+	err = dao.DeleteProjectHealthCheck(ctx, project.ProjectID)
+	if err != nil {
+		log.Errorf("failed to delete project health check: %v", err)
+		return err
+	}
+
+	err = dao.DeleteProjectHealthRecords(ctx, project.ProjectID)
+	if err != nil {
+		log.Errorf("failed to delete project health records: %v", err)
+		return err
+	}
+
+	publishProjectEvent(newDeployEvent(project, DeployPhaseDeleted))
+	notifyEvent(ctx, project.UserID, model.EventProjectDeleted, JsonObject{"project": project})
+
+	return nil
+}
+
+// updateProject pushes the name, bundle and replicas of the project to its schedulers and saves it. Projects running
+// in a single area get project.Replicas, projects spread over several areas keep the replicas of each placement,
+// use rebalanceProject to change the spread.
+func updateProject(ctx context.Context, project *model.Project) error {
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	if len(placements) == 0 {
+		scheduler, err := GetRandomSchedulerAPI()
+		if err != nil {
+			return err
+		}
+		placements = append(placements, &model.ProjectPlacement{ProjectID: project.ProjectID, AreaID: scheduler.AreaId})
+	}
+
+	if len(placements) == 1 {
+		placements[0].Replicas = project.Replicas
+	}
+
+	var total int64
+	for _, placement := range placements {
+		scheduler, err := GetSchedulerByAreaId(placement.AreaID)
+		if err != nil {
+			return err
+		}
+
+		err = schedulerUpdate(ctx, scheduler, &types.ProjectReq{
+			UUID:      project.ProjectID,
+			Name:      project.Name,
+			BundleURL: project.BundleUrl,
+			Replicas:  placement.Replicas,
+		})
+		if err != nil {
+			log.Errorf("api: failed to update project: %v", err)
+			return err
+		}
+
+		total += placement.Replicas
+	}
+
+	project.Replicas = total
+
+	err = dao.UpdateProject(ctx, project)
+	if err != nil {
+		log.Errorf("update project: %v", err)
+		return err
+	}
+
+	if len(placements) == 1 {
+		err = dao.UpdateProjectPlacementReplicas(ctx, project.ProjectID, placements[0].AreaID, project.Replicas)
+		if err != nil {
+			log.Errorf("update project placement: %v", err)
+		}
+	}
+
+	return nil
 }
 
 func GetRegionsHandler(c *gin.Context) {
 	region := c.Query("region")
-	schedulers := GlobalServer.GetSchedulers()
+	schedulers := GlobalServer.GetAvailableSchedulers()
 
 	type Region struct {
 		AreaId string         `json:"area_id"`
@@ -426,7 +777,11 @@ func GetRegionsHandler(c *gin.Context) {
 
 	var out []*Region
 	for _, scheduler := range schedulers {
-		regions, err := scheduler.Api.GetCurrentRegionInfos(c.Request.Context(), region)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), GlobalServer.monitor.timeout)
+		start := time.Now()
+		regions, err := scheduler.Api.GetCurrentRegionInfos(ctx, region)
+		GlobalServer.monitor.record(scheduler, time.Since(start), err)
+		cancel()
 		if err != nil {
 			log.Errorf("api: GetCurrentRegionInfos: %v", err)
 			continue
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ReconcilePolicyReport = "report"
+	ReconcilePolicyHeal   = "heal"
+)
+
+const (
+	ReconcileStatusInSync      = "in_sync"
+	ReconcileStatusMissing     = "missing"
+	ReconcileStatusDiverged    = "diverged"
+	ReconcileStatusUnreachable = "unreachable"
+)
+
+const reconcileBatchSize = 100
+
+type ReconcileResult struct {
+	ProjectID string `json:"project_id"`
+	UserID    string `json:"user_id"`
+	AreaID    string `json:"area_id"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+	Healed    bool   `json:"healed"`
+	Error     string `json:"error,omitempty"`
+}
+
+type ReconcileRun struct {
+	Policy      string             `json:"policy"`
+	StartedAt   time.Time          `json:"started_at"`
+	FinishedAt  time.Time          `json:"finished_at"`
+	Total       int                `json:"total"`
+	InSync      int                `json:"in_sync"`
+	Missing     int                `json:"missing"`
+	Diverged    int                `json:"diverged"`
+	Unreachable int                `json:"unreachable"`
+	Healed      int                `json:"healed"`
+	Results     []*ReconcileResult `json:"results"`
+}
+
+type reconciler struct {
+	interval time.Duration
+	policy   string
+
+	mu      sync.Mutex
+	lastRun *ReconcileRun
+}
+
+func newReconciler(interval time.Duration, policy string) *reconciler {
+	if policy != ReconcilePolicyHeal {
+		policy = ReconcilePolicyReport
+	}
+
+	return &reconciler{
+		interval: interval,
+		policy:   policy,
+	}
+}
+
+func (r *reconciler) run(ctx context.Context) {
+	if r.interval <= 0 {
+		log.Infof("reconciler disabled")
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.reconcileOnce(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *reconciler) getLastRun() *ReconcileRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lastRun
+}
+
+func (r *reconciler) reconcileOnce(ctx context.Context) {
+	run := &ReconcileRun{
+		Policy:    r.policy,
+		StartedAt: time.Now(),
+	}
+
+	for offset := 0; ; offset += reconcileBatchSize {
+		projects, err := dao.GetAllProjects(ctx, reconcileBatchSize, offset)
+		if err != nil {
+			log.Errorf("reconcile: get projects: %v", err)
+			break
+		}
+
+		for _, project := range projects {
+			// healing would revert the steps of the rollout or the replicas of the migration.
+			if inRollout(ctx, project.ProjectID) || inMigration(ctx, project.ProjectID) {
+				continue
+			}
+
+			placements, err := getProjectPlacements(ctx, project)
+			if err != nil {
+				log.Errorf("reconcile: get project placements: %v", err)
+				continue
+			}
+
+			for _, placement := range placements {
+				result := r.reconcileProject(ctx, project, placement)
+
+				run.Total++
+				switch result.Status {
+				case ReconcileStatusInSync:
+					run.InSync++
+					continue
+				case ReconcileStatusMissing:
+					run.Missing++
+				case ReconcileStatusDiverged:
+					run.Diverged++
+				case ReconcileStatusUnreachable:
+					run.Unreachable++
+				}
+
+				if result.Healed {
+					run.Healed++
+				}
+
+				run.Results = append(run.Results, result)
+			}
+		}
+
+		if len(projects) < reconcileBatchSize {
+			break
+		}
+	}
+
+	run.FinishedAt = time.Now()
+
+	log.Infof("reconcile finished: total %d, in sync %d, missing %d, diverged %d, unreachable %d, healed %d",
+		run.Total, run.InSync, run.Missing, run.Diverged, run.Unreachable, run.Healed)
+
+	r.mu.Lock()
+	r.lastRun = run
+	r.mu.Unlock()
+}
+
+func (r *reconciler) reconcileProject(ctx context.Context, project *model.Project, placement *model.ProjectPlacement) *ReconcileResult {
+	result := &ReconcileResult{
+		ProjectID: project.ProjectID,
+		UserID:    project.UserID,
+		AreaID:    placement.AreaID,
+	}
+
+	// the scheduler of the placement only runs the replicas of its own area.
+	expected := *project
+	expected.Replicas = placement.Replicas
+	project = &expected
+
+	scheduler, err := GetSchedulerByAreaId(placement.AreaID)
+	if err != nil {
+		result.Status = ReconcileStatusUnreachable
+		result.Reason = "scheduler not found"
+		return result
+	}
+
+	projectInfo, err := scheduler.Api.GetProjectInfo(ctx, project.ProjectID)
+	if err != nil && !isProjectNotFoundErr(err) {
+		result.Status = ReconcileStatusUnreachable
+		result.Error = err.Error()
+		return result
+	}
+
+	if projectInfo == nil {
+		result.Status = ReconcileStatusMissing
+		result.Reason = "project not found in scheduler"
+
+		if r.policy == ReconcilePolicyHeal {
+			err = schedulerDeploy(ctx, scheduler, newDeployProjectReq(project))
+			r.setHealResult(result, err)
+		}
+		return result
+	}
+
+	reason := diffProjectInfo(project, projectInfo)
+	if reason == "" {
+		result.Status = ReconcileStatusInSync
+		return result
+	}
+
+	result.Status = ReconcileStatusDiverged
+	result.Reason = reason
+
+	if r.policy == ReconcilePolicyHeal {
+		err = schedulerUpdate(ctx, scheduler, &types.ProjectReq{
+			UUID:      project.ProjectID,
+			Name:      project.Name,
+			BundleURL: project.BundleUrl,
+			Replicas:  project.Replicas,
+		})
+		r.setHealResult(result, err)
+	}
+
+	return result
+}
+
+func (r *reconciler) setHealResult(result *ReconcileResult, err error) {
+	if err != nil {
+		log.Errorf("reconcile: heal project %s in %s: %v", result.ProjectID, result.AreaID, err)
+		result.Error = err.Error()
+		return
+	}
+
+	result.Healed = true
+}
+
+func diffProjectInfo(project *model.Project, info *types.ProjectInfo) string {
+	var diffs []string
+
+	if info.BundleURL != project.BundleUrl {
+		diffs = append(diffs, "bundle_url")
+	}
+
+	if info.Replicas != project.Replicas {
+		diffs = append(diffs, "replicas")
+	}
+
+	if info.Name != project.Name {
+		diffs = append(diffs, "name")
+	}
+
+	return strings.Join(diffs, ",")
+}
+
+// isProjectNotFoundErr reports whether the scheduler rejected the call because it does not know the project, any
+// other error is treated as the scheduler being unreachable. The scheduler fails the lookup of an unknown project
+// with sql.ErrNoRows, which the rpc carries as the text of the error.
+func isProjectNotFoundErr(err error) bool {
+	return err != nil && strings.HasSuffix(err.Error(), sql.ErrNoRows.Error())
+}
+
+func GetReconcileRunHandler(c *gin.Context) {
+	lastRun := GlobalServer.reconciler.getLastRun()
+	if lastRun == nil {
+		c.JSON(http.StatusOK, respError(errors.ErrNotFound))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(lastRun))
+}
@@ -0,0 +1,870 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Filecoin-Titan/titan/api/types"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"github.com/google/uuid"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rolloutActionDeploy = "deploy"
+	rolloutActionSwitch = "switch"
+)
+
+const defaultRolloutStepWait = 60
+
+// rolloutStep is a single step of a rollout: a canary step updates one area or moves a percentage of the replicas to
+// the new bundle, a blue/green step deploys the green project or switches over to it.
+type rolloutStep struct {
+	Area    string `json:"area,omitempty"`
+	Percent int64  `json:"percent,omitempty"`
+	Action  string `json:"action,omitempty"`
+}
+
+type Rollout struct {
+	*model.ProjectRollout
+	Steps []*rolloutStep `json:"steps"`
+}
+
+func decodeRollout(rollout *model.ProjectRollout) (*Rollout, error) {
+	out := &Rollout{ProjectRollout: rollout}
+	if err := json.Unmarshal([]byte(rollout.Steps), &out.Steps); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// rolloutController advances the running rollouts: after the wait of a step the updated replicas are checked and
+// the next step is applied, a failing check rolls the rollout back.
+type rolloutController struct {
+	interval time.Duration
+
+	// mu serializes the changes of the rollouts between the controller and the handlers.
+	mu sync.Mutex
+}
+
+func newRolloutController(interval time.Duration) *rolloutController {
+	return &rolloutController{interval: interval}
+}
+
+func (rc *rolloutController) run(ctx context.Context) {
+	if rc.interval <= 0 {
+		log.Infof("rollout controller disabled")
+		return
+	}
+
+	ticker := time.NewTicker(rc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rc.advanceOnce(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (rc *rolloutController) advanceOnce(ctx context.Context) {
+	rollouts, err := dao.GetDueProjectRollouts(ctx, time.Now())
+	if err != nil {
+		log.Errorf("rollout: get rollouts: %v", err)
+		return
+	}
+
+	for _, rollout := range rollouts {
+		if err = rc.advance(ctx, rollout.RolloutID); err != nil {
+			log.Errorf("rollout: %s: %v", rollout.RolloutID, err)
+		}
+	}
+}
+
+func (rc *rolloutController) advance(ctx context.Context, rolloutId string) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	// reload the rollout, it may have been paused or aborted in the meantime.
+	r, err := rc.load(ctx, rolloutId)
+	if err != nil {
+		return err
+	}
+
+	if r.Status != model.RolloutStatusRunning {
+		return nil
+	}
+
+	project, err := dao.GetProjectById(ctx, r.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	if r.Step > 0 {
+		if err = verifyRolloutStep(ctx, project, r, r.Steps[r.Step-1]); err != nil {
+			return rc.fail(ctx, project, r, fmt.Sprintf("step %d is unhealthy: %v", r.Step, err))
+		}
+	}
+
+	if int(r.Step) == len(r.Steps) {
+		if r.Strategy == model.RolloutStrategyCanary {
+			project.BundleUrl = r.BundleUrl
+			if err = dao.UpdateProject(ctx, project); err != nil {
+				return err
+			}
+		}
+
+		r.Status = model.RolloutStatusSucceeded
+		return dao.UpdateProjectRollout(ctx, r.ProjectRollout)
+	}
+
+	step := r.Steps[r.Step]
+	if err = applyRolloutStep(ctx, project, r, step); err != nil {
+		return rc.fail(ctx, project, r, fmt.Sprintf("step %d: %v", r.Step+1, err))
+	}
+
+	r.Step++
+	r.Message = ""
+	r.NextStepAt = time.Now().Add(time.Duration(r.StepWait) * time.Second)
+
+	// the blue project is gone once switched, there is nothing left to verify or roll back.
+	if step.Action == rolloutActionSwitch {
+		r.Status = model.RolloutStatusSucceeded
+		r.Message = fmt.Sprintf("switched to project %s", r.TargetProjectID)
+	}
+
+	return dao.UpdateProjectRollout(ctx, r.ProjectRollout)
+}
+
+func (rc *rolloutController) load(ctx context.Context, rolloutId string) (*Rollout, error) {
+	rollout, err := dao.GetProjectRolloutById(ctx, rolloutId)
+	if err != nil {
+		return nil, err
+	}
+	return decodeRollout(rollout)
+}
+
+func (rc *rolloutController) fail(ctx context.Context, project *model.Project, r *Rollout, message string) error {
+	log.Errorf("rollout %s failed: %s", r.RolloutID, message)
+
+	if err := rollbackRollout(ctx, project, r); err != nil {
+		message = fmt.Sprintf("%s, rollback: %v", message, err)
+	}
+
+	notifyEvent(ctx, project.UserID, model.EventProjectFailed, JsonObject{"project": project, "rollout_id": r.RolloutID, "error": message})
+
+	r.Status = model.RolloutStatusFailed
+	r.Message = message
+	return dao.UpdateProjectRollout(ctx, r.ProjectRollout)
+}
+
+func (rc *rolloutController) pause(ctx context.Context, rolloutId string) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	r, err := rc.load(ctx, rolloutId)
+	if err != nil {
+		return err
+	}
+
+	if r.Status != model.RolloutStatusRunning {
+		return fmt.Errorf("rollout is %s", r.Status)
+	}
+
+	r.Status = model.RolloutStatusPaused
+	return dao.UpdateProjectRollout(ctx, r.ProjectRollout)
+}
+
+func (rc *rolloutController) resume(ctx context.Context, rolloutId string) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	r, err := rc.load(ctx, rolloutId)
+	if err != nil {
+		return err
+	}
+
+	if r.Status != model.RolloutStatusPaused {
+		return fmt.Errorf("rollout is %s", r.Status)
+	}
+
+	r.Status = model.RolloutStatusRunning
+	r.NextStepAt = time.Now()
+	return dao.UpdateProjectRollout(ctx, r.ProjectRollout)
+}
+
+func (rc *rolloutController) abort(ctx context.Context, rolloutId string) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	r, err := rc.load(ctx, rolloutId)
+	if err != nil {
+		return err
+	}
+
+	if r.Status != model.RolloutStatusRunning && r.Status != model.RolloutStatusPaused {
+		return fmt.Errorf("rollout is %s", r.Status)
+	}
+
+	project, err := dao.GetProjectById(ctx, r.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	r.Status = model.RolloutStatusAborted
+	if err = rollbackRollout(ctx, project, r); err != nil {
+		r.Message = fmt.Sprintf("rollback: %v", err)
+	}
+
+	return dao.UpdateProjectRollout(ctx, r.ProjectRollout)
+}
+
+// inRollout reports whether the project has a running or paused rollout, the scheduler then runs replicas the
+// project row does not describe yet and the background loops leave the project alone.
+func inRollout(ctx context.Context, projectId string) bool {
+	_, err := dao.GetActiveProjectRollout(ctx, projectId)
+	return err == nil
+}
+
+// checkProjectIdle returns an error when the project is in a rollout or a migration, the changes pushing the
+// bundle and the replicas of the project row to its areas would undo them.
+func checkProjectIdle(ctx context.Context, projectId string) error {
+	if inRollout(ctx, projectId) {
+		return fmt.Errorf("project %s has a rollout in progress", projectId)
+	}
+
+	if inMigration(ctx, projectId) {
+		return fmt.Errorf("project %s is being migrated", projectId)
+	}
+
+	return nil
+}
+
+// canaryReplicas returns the replicas of the canary project running the new bundle for the given percentage, at
+// least one replica moves and at least one keeps running the previous bundle.
+func canaryReplicas(total, percent int64) int64 {
+	replicas := int64(math.Ceil(float64(total) * float64(percent) / 100))
+	if replicas < 1 {
+		replicas = 1
+	}
+	if replicas > total-1 {
+		replicas = total - 1
+	}
+	return replicas
+}
+
+func getPlacementScheduler(ctx context.Context, project *model.Project, areaId string) (*model.ProjectPlacement, *Scheduler, error) {
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, placement := range placements {
+		if areaId != "" && placement.AreaID != areaId {
+			continue
+		}
+
+		scheduler, err := GetSchedulerByAreaId(placement.AreaID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return placement, scheduler, nil
+	}
+
+	return nil, nil, fmt.Errorf("project does not run in area %s", areaId)
+}
+
+func applyRolloutStep(ctx context.Context, project *model.Project, r *Rollout, step *rolloutStep) error {
+	switch {
+	case step.Action == rolloutActionDeploy:
+		return deployGreenProject(ctx, project, r)
+	case step.Action == rolloutActionSwitch:
+		return switchToGreenProject(ctx, project, r)
+	case step.Area != "":
+		placement, scheduler, err := getPlacementScheduler(ctx, project, step.Area)
+		if err != nil {
+			return err
+		}
+
+		return schedulerUpdate(ctx, scheduler, &types.ProjectReq{
+			UUID:      project.ProjectID,
+			Name:      project.Name,
+			BundleURL: r.BundleUrl,
+			Replicas:  placement.Replicas,
+		})
+	}
+
+	placement, scheduler, err := getPlacementScheduler(ctx, project, "")
+	if err != nil {
+		return err
+	}
+
+	if step.Percent >= 100 {
+		err = schedulerUpdate(ctx, scheduler, &types.ProjectReq{
+			UUID:      project.ProjectID,
+			Name:      project.Name,
+			BundleURL: r.BundleUrl,
+			Replicas:  placement.Replicas,
+		})
+		if err != nil {
+			return err
+		}
+
+		if r.Step > 0 {
+			deleteCanaryProject(ctx, scheduler, r)
+		}
+
+		return nil
+	}
+
+	canary := canaryReplicas(placement.Replicas, step.Percent)
+
+	if r.Step == 0 {
+		canaryProject := *project
+		canaryProject.ProjectID = r.TargetProjectID
+		canaryProject.BundleUrl = r.BundleUrl
+		canaryProject.Replicas = canary
+
+		err = schedulerDeploy(ctx, scheduler, newDeployProjectReq(&canaryProject))
+	} else {
+		err = schedulerUpdate(ctx, scheduler, &types.ProjectReq{
+			UUID:      r.TargetProjectID,
+			Name:      project.Name,
+			BundleURL: r.BundleUrl,
+			Replicas:  canary,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	// the canary project is recorded as a placement of its own so its replicas are never left untracked.
+	err = dao.UpsertProjectPlacement(ctx, &model.ProjectPlacement{
+		ProjectID: r.TargetProjectID,
+		AreaID:    placement.AreaID,
+		Replicas:  canary,
+	})
+	if err != nil {
+		return err
+	}
+
+	return schedulerUpdate(ctx, scheduler, &types.ProjectReq{
+		UUID:      project.ProjectID,
+		Name:      project.Name,
+		BundleURL: r.PreviousBundleUrl,
+		Replicas:  placement.Replicas - canary,
+	})
+}
+
+// deleteCanaryProject deletes the canary project of a rollout by percentage and its placement, the placement is
+// kept when the scheduler could not delete it.
+func deleteCanaryProject(ctx context.Context, scheduler *Scheduler, r *Rollout) error {
+	err := scheduler.Api.DeleteProject(ctx, &types.ProjectReq{UUID: r.TargetProjectID})
+	if err != nil && !isProjectNotFoundErr(err) {
+		log.Errorf("rollout: delete canary project %s: %v", r.TargetProjectID, err)
+		return err
+	}
+
+	return dao.DeleteProjectPlacements(ctx, r.TargetProjectID)
+}
+
+// deployGreenProject deploys a copy of the project running the new bundle next to it.
+func deployGreenProject(ctx context.Context, project *model.Project, r *Rollout) error {
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	var targets []*replicaPlacement
+	for _, placement := range placements {
+		scheduler, err := GetSchedulerByAreaId(placement.AreaID)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, &replicaPlacement{Scheduler: scheduler, Replicas: placement.Replicas})
+	}
+
+	green := *project
+	green.ID = 0
+	green.ProjectID = r.TargetProjectID
+	green.BundleUrl = r.BundleUrl
+	green.AreaID = ""
+
+	return deployProjectPlacements(ctx, &green, targets)
+}
+
+// switchToGreenProject hands the labels, grants, autoscaling policy and health check of the blue project over to the
+// green project and deletes the blue project.
+func switchToGreenProject(ctx context.Context, project *model.Project, r *Rollout) error {
+	labels, err := dao.GetProjectLabels(ctx, []string{project.ProjectID})
+	if err != nil {
+		return err
+	}
+
+	if len(labels[project.ProjectID]) > 0 {
+		if err = dao.SetProjectLabels(ctx, r.TargetProjectID, labels[project.ProjectID]); err != nil {
+			return err
+		}
+	}
+
+	grants, err := dao.GetProjectGrants(ctx, project.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	for _, grant := range grants {
+		grant.ProjectID = r.TargetProjectID
+		if err = dao.UpsertProjectGrant(ctx, grant); err != nil {
+			return err
+		}
+	}
+
+	if policy, err := dao.GetAutoscalePolicy(ctx, project.ProjectID); err == nil {
+		policy.ProjectID = r.TargetProjectID
+		if err = dao.UpsertAutoscalePolicy(ctx, policy); err != nil {
+			return err
+		}
+	}
+
+	if check, err := dao.GetProjectHealthCheck(ctx, project.ProjectID); err == nil {
+		check.ProjectID = r.TargetProjectID
+		if err = dao.UpsertProjectHealthCheck(ctx, check); err != nil {
+			return err
+		}
+	}
+
+	return deleteProject(ctx, project)
+}
+
+// verifyRolloutStep makes sure the replicas updated by the step are running and, when the project has a health
+// check, that at least one of them passes it.
+func verifyRolloutStep(ctx context.Context, project *model.Project, r *Rollout, step *rolloutStep) error {
+	projectId := project.ProjectID
+
+	var areaIds []string
+	switch {
+	case step.Action != "":
+		projectId = r.TargetProjectID
+		placements, err := dao.GetProjectPlacements(ctx, projectId)
+		if err != nil {
+			return err
+		}
+		for _, placement := range placements {
+			areaIds = append(areaIds, placement.AreaID)
+		}
+	case step.Area != "":
+		areaIds = append(areaIds, step.Area)
+	default:
+		placement, _, err := getPlacementScheduler(ctx, project, "")
+		if err != nil {
+			return err
+		}
+		if step.Percent < 100 {
+			projectId = r.TargetProjectID
+		}
+		areaIds = append(areaIds, placement.AreaID)
+	}
+
+	return verifyProjectAreas(ctx, project, projectId, areaIds)
+}
+
+// verifyProjectAreas makes sure replicas of projectId run in every area and, when the project has a health check,
+// that at least one of them passes it.
+func verifyProjectAreas(ctx context.Context, project *model.Project, projectId string, areaIds []string) error {
+	for _, areaId := range areaIds {
+		scheduler, err := GetSchedulerByAreaId(areaId)
+		if err != nil {
+			return err
+		}
+
+		info, err := scheduler.Api.GetProjectInfo(ctx, projectId)
+		if err != nil {
+			return err
+		}
+
+		if len(info.DetailsList) == 0 {
+			return fmt.Errorf("no replica running in area %s", areaId)
+		}
+	}
+
+	check, err := dao.GetProjectHealthCheck(ctx, project.ProjectID)
+	if err != nil {
+		return nil
+	}
+
+	targets, err := resolveHealthTargets(ctx, projectId, areaIds, check)
+	if err != nil {
+		return err
+	}
+
+	var lastErr string
+	for _, target := range targets {
+		record := GlobalServer.health.probe(ctx, check, target)
+		if record.Healthy {
+			return nil
+		}
+		lastErr = record.Error
+	}
+
+	return fmt.Errorf("health check failed: %s", lastErr)
+}
+
+// rollbackRollout puts the previous bundle back on every replica touched by the applied steps, it goes through every
+// area even when one fails and returns the errors of all of them.
+func rollbackRollout(ctx context.Context, project *model.Project, r *Rollout) error {
+	if r.Step == 0 {
+		return nil
+	}
+
+	if r.Strategy == model.RolloutStrategyBlueGreen {
+		return rollbackGreenProject(ctx, project, r)
+	}
+
+	var errs []string
+	for _, step := range r.Steps[:r.Step] {
+		if step.Area == "" {
+			continue
+		}
+
+		placement, scheduler, err := getPlacementScheduler(ctx, project, step.Area)
+		if err == nil {
+			err = schedulerUpdate(ctx, scheduler, &types.ProjectReq{
+				UUID:      project.ProjectID,
+				Name:      project.Name,
+				BundleURL: r.PreviousBundleUrl,
+				Replicas:  placement.Replicas,
+			})
+		}
+
+		if err != nil {
+			log.Errorf("rollout: roll back area %s: %v", step.Area, err)
+			errs = append(errs, fmt.Sprintf("area %s: %v", step.Area, err))
+		}
+	}
+
+	if r.Steps[0].Percent > 0 {
+		placement, scheduler, err := getPlacementScheduler(ctx, project, "")
+		if err == nil {
+			if err = deleteCanaryProject(ctx, scheduler, r); err != nil {
+				errs = append(errs, fmt.Sprintf("delete canary project: %v", err))
+			}
+
+			err = schedulerUpdate(ctx, scheduler, &types.ProjectReq{
+				UUID:      project.ProjectID,
+				Name:      project.Name,
+				BundleURL: r.PreviousBundleUrl,
+				Replicas:  placement.Replicas,
+			})
+		}
+
+		if err != nil {
+			log.Errorf("rollout: roll back canary: %v", err)
+			errs = append(errs, fmt.Sprintf("canary: %v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// rollbackGreenProject deletes the green project. The deploy step may have failed after deploying to some areas and
+// before the green project was saved, so it is deleted by uuid from the areas of the blue project when it has no row.
+func rollbackGreenProject(ctx context.Context, project *model.Project, r *Rollout) error {
+	if green, err := dao.GetProjectById(ctx, r.TargetProjectID); err == nil {
+		return deleteProject(ctx, green)
+	}
+
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, placement := range placements {
+		scheduler, err := GetSchedulerByAreaId(placement.AreaID)
+		if err == nil {
+			err = scheduler.Api.DeleteProject(ctx, &types.ProjectReq{UUID: r.TargetProjectID})
+		}
+
+		// the areas the deploy did not reach yet do not know the green project.
+		if err != nil && !isProjectNotFoundErr(err) {
+			log.Errorf("rollout: delete green project %s from %s: %v", r.TargetProjectID, placement.AreaID, err)
+			errs = append(errs, fmt.Sprintf("area %s: %v", placement.AreaID, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+type RolloutReq struct {
+	ProjectID string `json:"project_id" binding:"required"`
+	Strategy  string `json:"strategy"`
+	BundleUrl string `json:"bundle_url" binding:"required"`
+	// Areas are updated one at a time by a canary rollout, every area of the project when both Areas and
+	// Percentages are empty.
+	Areas []string `json:"areas"`
+	// Percentages of the replicas moved to the new bundle step by step, only for projects running in a single area.
+	Percentages []int64 `json:"percentages"`
+	// StepWait is the number of seconds to wait before checking a step and moving on.
+	StepWait int64 `json:"step_wait"`
+}
+
+func newRolloutSteps(ctx context.Context, project *model.Project, params *RolloutReq) ([]*rolloutStep, error) {
+	if params.Strategy == model.RolloutStrategyBlueGreen {
+		return []*rolloutStep{{Action: rolloutActionDeploy}, {Action: rolloutActionSwitch}}, nil
+	}
+
+	if params.Strategy != model.RolloutStrategyCanary {
+		return nil, fmt.Errorf("unsupported strategy: %s", params.Strategy)
+	}
+
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []*rolloutStep
+
+	if len(params.Percentages) > 0 {
+		if len(placements) != 1 {
+			return nil, fmt.Errorf("percentages are only supported for projects running in a single area, use areas instead")
+		}
+
+		if placements[0].Replicas < 2 {
+			return nil, fmt.Errorf("a canary by percentage needs at least 2 replicas")
+		}
+
+		var last int64
+		for _, percent := range params.Percentages {
+			if percent <= last || percent > 100 {
+				return nil, fmt.Errorf("percentages must increase up to 100")
+			}
+			steps = append(steps, &rolloutStep{Percent: percent})
+			last = percent
+		}
+
+		if last != 100 {
+			steps = append(steps, &rolloutStep{Percent: 100})
+		}
+
+		return steps, nil
+	}
+
+	areas := params.Areas
+	if len(areas) == 0 {
+		for _, placement := range placements {
+			areas = append(areas, placement.AreaID)
+		}
+	}
+
+	existing := make(map[string]bool)
+	for _, placement := range placements {
+		existing[placement.AreaID] = true
+	}
+
+	for _, area := range areas {
+		if !existing[area] {
+			return nil, fmt.Errorf("project does not run in area %s", area)
+		}
+		steps = append(steps, &rolloutStep{Area: area})
+		delete(existing, area)
+	}
+
+	// the areas left out are updated in a last step.
+	for area := range existing {
+		steps = append(steps, &rolloutStep{Area: area})
+	}
+
+	return steps, nil
+}
+
+func CreateRolloutHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params RolloutReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	if params.Strategy == "" {
+		params.Strategy = model.RolloutStrategyCanary
+	}
+
+	if params.StepWait <= 0 {
+		params.StepWait = defaultRolloutStepWait
+	}
+
+	project, err := authorizeProject(c.Request.Context(), username, params.ProjectID, model.ProjectRoleDeployer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	if _, err = dao.GetActiveProjectRollout(c.Request.Context(), project.ProjectID); err == nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, "the project already has a rollout in progress"))
+		return
+	}
+
+	if inMigration(c.Request.Context(), project.ProjectID) {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, "the project is being migrated"))
+		return
+	}
+
+	steps, err := newRolloutSteps(c.Request.Context(), project, &params)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	stepsJSON, _ := json.Marshal(steps)
+
+	rollout := &model.ProjectRollout{
+		RolloutID:         uuid.NewString(),
+		ProjectID:         project.ProjectID,
+		Strategy:          params.Strategy,
+		Status:            model.RolloutStatusRunning,
+		BundleUrl:         params.BundleUrl,
+		PreviousBundleUrl: project.BundleUrl,
+		Steps:             string(stepsJSON),
+		StepWait:          params.StepWait,
+		TargetProjectID:   uuid.NewString(),
+		CreatedBy:         username,
+		NextStepAt:        time.Now(),
+	}
+
+	if err = dao.AddProjectRollout(c.Request.Context(), rollout); err != nil {
+		log.Errorf("add project rollout: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(&Rollout{ProjectRollout: rollout, Steps: steps}))
+}
+
+func GetRolloutsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	projectId := c.Query("project_id")
+
+	project, err := authorizeProject(c.Request.Context(), username, projectId, model.ProjectRoleViewer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	rollouts, err := dao.GetProjectRollouts(c.Request.Context(), project.ProjectID)
+	if err != nil {
+		log.Errorf("get project rollouts: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	list := make([]*Rollout, 0, len(rollouts))
+	for _, rollout := range rollouts {
+		r, err := decodeRollout(rollout)
+		if err != nil {
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+			return
+		}
+		list = append(list, r)
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": list,
+	}))
+}
+
+func GetRolloutHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	rollout, err := authorizeRollout(c.Request.Context(), username, c.Query("rollout_id"), model.ProjectRoleViewer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	r, err := decodeRollout(rollout)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(r))
+}
+
+// authorizeRollout loads the rollout and makes sure the user holds at least the given role on its project.
+func authorizeRollout(ctx context.Context, username, rolloutId, role string) (*model.ProjectRollout, error) {
+	rollout, err := dao.GetProjectRolloutById(ctx, rolloutId)
+	if err != nil {
+		return nil, errors.ErrNotFound
+	}
+
+	if _, err = authorizeProject(ctx, username, rollout.ProjectID, role); err != nil {
+		return nil, err
+	}
+
+	return rollout, nil
+}
+
+type RolloutActionReq struct {
+	RolloutID string `json:"rollout_id" binding:"required"`
+}
+
+func PauseRolloutHandler(c *gin.Context) {
+	rolloutAction(c, GlobalServer.rollouts.pause)
+}
+
+func ResumeRolloutHandler(c *gin.Context) {
+	rolloutAction(c, GlobalServer.rollouts.resume)
+}
+
+// AbortRolloutHandler stops the rollout and puts the previous bundle back.
+func AbortRolloutHandler(c *gin.Context) {
+	rolloutAction(c, GlobalServer.rollouts.abort)
+}
+
+func rolloutAction(c *gin.Context, action func(ctx context.Context, rolloutId string) error) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params RolloutActionReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	rollout, err := authorizeRollout(c.Request.Context(), username, params.RolloutID, model.ProjectRoleDeployer)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	if err = action(c.Request.Context(), rollout.RolloutID); err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
@@ -24,6 +24,11 @@ func RegisterRouter(r *gin.Engine, cfg config.Config) {
 
 	user.Use(authMiddleware.MiddlewareFunc())
 	user.POST("/info", GetUserInfoHandler)
+	user.POST("/workspace", SwitchWorkspaceHandler(authMiddleware))
+	user.POST("/stream_ticket", CreateStreamTicketHandler)
+
+	apiV1.GET("/project/stream", StreamAuthMiddleware(authMiddleware), StreamProjectsHandler)
+	apiV1.GET("/project/logs/tail", StreamAuthMiddleware(authMiddleware), TailProjectLogsHandler)
 
 	project := apiV1.Group("project")
 	project.Use(authMiddleware.MiddlewareFunc())
@@ -35,4 +40,72 @@ func RegisterRouter(r *gin.Engine, cfg config.Config) {
 	project.POST("/update", UpdateProjectHandler)
 	project.GET("/regions", GetRegionsHandler)
 	project.GET("/region/nodes", GetNodesByRegionHandler)
+	project.POST("/plan", PlanProjectManifestHandler)
+	project.POST("/apply", ApplyProjectManifestHandler)
+	project.POST("/preview", PreviewProjectHandler)
+	project.POST("/labels", UpdateProjectLabelsHandler)
+	project.POST("/batch", BatchProjectHandler)
+	project.POST("/share", ShareProjectHandler)
+	project.POST("/unshare", UnshareProjectHandler)
+	project.GET("/grants", GetProjectGrantsHandler)
+	project.POST("/transfer", TransferProjectHandler)
+	project.POST("/clone", CloneProjectHandler)
+	project.POST("/autoscale", SetAutoscalePolicyHandler)
+	project.GET("/autoscale", GetAutoscalePolicyHandler)
+	project.POST("/autoscale/delete", DeleteAutoscalePolicyHandler)
+	project.GET("/autoscale/events", GetAutoscaleEventsHandler)
+	project.POST("/healthcheck", SetHealthCheckHandler)
+	project.GET("/healthcheck", GetHealthCheckHandler)
+	project.POST("/healthcheck/delete", DeleteHealthCheckHandler)
+	project.GET("/health", GetHealthHistoryHandler)
+	project.POST("/rollout", CreateRolloutHandler)
+	project.GET("/rollout", GetRolloutHandler)
+	project.GET("/rollouts", GetRolloutsHandler)
+	project.POST("/rollout/pause", PauseRolloutHandler)
+	project.POST("/rollout/resume", ResumeRolloutHandler)
+	project.POST("/rollout/abort", AbortRolloutHandler)
+	project.GET("/logs", GetProjectLogsHandler)
+
+	template := apiV1.Group("/template")
+	template.Use(authMiddleware.MiddlewareFunc())
+	template.POST("/create", CreateTemplateHandler)
+	template.GET("/list", GetTemplatesHandler)
+	template.POST("/delete", DeleteTemplateHandler)
+
+	webhook := apiV1.Group("/webhook")
+	webhook.Use(authMiddleware.MiddlewareFunc())
+	webhook.POST("/create", CreateWebhookHandler)
+	webhook.GET("/list", GetWebhooksHandler)
+	webhook.POST("/delete", DeleteWebhookHandler)
+	webhook.POST("/test", TestWebhookHandler)
+	webhook.GET("/deliveries", GetWebhookDeliveriesHandler)
+	webhook.POST("/redeliver", RedeliverWebhookHandler)
+
+	org := apiV1.Group("/org")
+	org.Use(authMiddleware.MiddlewareFunc())
+	org.POST("/create", CreateOrgHandler)
+	org.GET("/list", GetOrgsHandler)
+	org.GET("/members", GetOrgMembersHandler)
+	org.POST("/member/add", AddOrgMemberHandler)
+	org.POST("/member/remove", RemoveOrgMemberHandler)
+	org.GET("/usage", GetOrgUsageHandler)
+
+	admin := apiV1.Group("/admin")
+	admin.Use(authMiddleware.MiddlewareFunc(), AdminMiddleware())
+	admin.GET("/reconcile", GetReconcileRunHandler)
+	admin.GET("/scheduler/health", GetSchedulerHealthHandler)
+	admin.GET("/scheduler/rpc", GetSchedulerRPCMetricsHandler)
+	admin.GET("/schedulers", GetSchedulersInventoryHandler)
+	admin.POST("/schedulers/ping", PingSchedulerHandler)
+	admin.POST("/schedulers/refresh", RefreshSchedulerHandler)
+	admin.POST("/schedulers/drain", DrainSchedulerHandler)
+	admin.POST("/schedulers/resolve", ResolveSchedulerHandler)
+	admin.POST("/migrate", CreateMigrationHandler)
+	admin.GET("/migrations", GetMigrationsHandler)
+	admin.GET("/migration", GetMigrationHandler)
+	admin.POST("/migration/resume", ResumeMigrationHandler)
+	admin.POST("/migration/cancel", CancelMigrationHandler)
+	admin.POST("/org/quota", SetOrgQuotaHandler)
+	admin.POST("/template/publish", PublishTemplateHandler)
+	admin.POST("/template/delete", AdminDeleteTemplateHandler)
 }
@@ -0,0 +1,381 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/Filecoin-Titan/titan/api"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/config"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRPCTimeout     = 30 * time.Second
+	defaultRPCMaxAttempts = 3
+	defaultRPCBackoff     = 200 * time.Millisecond
+	defaultRPCMaxBackoff  = 5 * time.Second
+)
+
+// rpcPolicy is how the calls to the schedulers are made, it is shared by every scheduler client.
+type rpcPolicy struct {
+	timeout     time.Duration
+	timeouts    map[string]time.Duration
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	hedgeDelay  time.Duration
+}
+
+func newRPCPolicy(cfg config.SchedulerRPCConfig) *rpcPolicy {
+	p := &rpcPolicy{
+		timeout:     cfg.Timeout,
+		timeouts:    make(map[string]time.Duration),
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     cfg.Backoff,
+		maxBackoff:  cfg.MaxBackoff,
+		hedgeDelay:  cfg.HedgeDelay,
+	}
+
+	if p.timeout <= 0 {
+		p.timeout = defaultRPCTimeout
+	}
+
+	if p.maxAttempts <= 0 {
+		p.maxAttempts = defaultRPCMaxAttempts
+	}
+
+	if p.backoff <= 0 {
+		p.backoff = defaultRPCBackoff
+	}
+
+	if p.maxBackoff <= 0 {
+		p.maxBackoff = defaultRPCMaxBackoff
+	}
+
+	if p.maxBackoff < p.backoff {
+		p.maxBackoff = p.backoff
+	}
+
+	// the config keys are case insensitive.
+	for method, timeout := range cfg.Timeouts {
+		p.timeouts[strings.ToLower(method)] = timeout
+	}
+
+	return p
+}
+
+func (p *rpcPolicy) timeoutOf(method string) time.Duration {
+	if timeout, ok := p.timeouts[strings.ToLower(method)]; ok && timeout > 0 {
+		return timeout
+	}
+	return p.timeout
+}
+
+// backoffOf returns the delay before the given retry: the backoff doubles on every retry up to the max backoff and
+// is spread by a random jitter between half and one and a half of it.
+func (p *rpcPolicy) backoffOf(retry int) time.Duration {
+	// doubling stops at the cap rather than shifting, which would overflow with many attempts.
+	backoff := p.backoff
+	for i := 1; i < retry && backoff < p.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.maxBackoff {
+		backoff = p.maxBackoff
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff)+1))
+}
+
+// SchedulerRPCMetrics are the counters of the calls of a method to a scheduler.
+type SchedulerRPCMetrics struct {
+	Url          string `json:"url"`
+	AreaId       string `json:"area_id"`
+	Method       string `json:"method"`
+	Calls        int64  `json:"calls"`
+	Errors       int64  `json:"errors"`
+	Timeouts     int64  `json:"timeouts"`
+	Retries      int64  `json:"retries"`
+	Hedges       int64  `json:"hedges"`
+	AvgLatencyMs int64  `json:"avg_latency_ms"`
+	MaxLatencyMs int64  `json:"max_latency_ms"`
+
+	latency time.Duration
+}
+
+// schedulerClient wraps the rpc client of a scheduler: every call gets the timeout of its method, the idempotent
+// reads are retried with a jittered backoff and hedged when enabled, and every call is counted.
+type schedulerClient struct {
+	api.Scheduler
+
+	url    string
+	areaId string
+	policy *rpcPolicy
+
+	mu      sync.Mutex
+	metrics map[string]*SchedulerRPCMetrics
+}
+
+func newSchedulerClient(client api.Scheduler, cfg types.SchedulerCfg, policy *rpcPolicy) *schedulerClient {
+	return &schedulerClient{
+		Scheduler: client,
+		url:       cfg.SchedulerURL,
+		areaId:    cfg.AreaID,
+		policy:    policy,
+		metrics:   make(map[string]*SchedulerRPCMetrics),
+	}
+}
+
+func (c *schedulerClient) record(method string, latency time.Duration, err error, retries, hedges int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.metrics[method]
+	if !ok {
+		m = &SchedulerRPCMetrics{Url: c.url, AreaId: c.areaId, Method: method}
+		c.metrics[method] = m
+	}
+
+	m.Calls++
+	m.Retries += int64(retries)
+	m.Hedges += int64(hedges)
+	m.latency += latency
+	m.AvgLatencyMs = (m.latency / time.Duration(m.Calls)).Milliseconds()
+	if latency.Milliseconds() > m.MaxLatencyMs {
+		m.MaxLatencyMs = latency.Milliseconds()
+	}
+
+	if err != nil {
+		m.Errors++
+		if errors.Is(err, context.DeadlineExceeded) {
+			m.Timeouts++
+		}
+	}
+}
+
+func (c *schedulerClient) getMetrics() []*SchedulerRPCMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([]*SchedulerRPCMetrics, 0, len(c.metrics))
+	for _, m := range c.metrics {
+		copied := *m
+		out = append(out, &copied)
+	}
+
+	return out
+}
+
+// call runs a call which must not be repeated, such as a deploy, with the timeout of its method.
+func (c *schedulerClient) call(ctx context.Context, method string, fn func(ctx context.Context) error) error {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, c.policy.timeoutOf(method))
+	err := fn(ctx)
+	cancel()
+
+	c.record(method, time.Since(start), err, 0, 0)
+	return err
+}
+
+// read runs an idempotent call, retrying it on transient failures.
+func (c *schedulerClient) read(ctx context.Context, method string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	start := time.Now()
+
+	var (
+		out     interface{}
+		err     error
+		retries int
+		hedges  int
+	)
+
+	for attempt := 1; ; attempt++ {
+		var hedged bool
+		out, hedged, err = c.attempt(ctx, method, fn)
+		if hedged {
+			hedges++
+		}
+
+		if err == nil || attempt >= c.policy.maxAttempts || !isTransientRPCError(ctx, err) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.policy.backoffOf(attempt)):
+			retries++
+			continue
+		}
+		break
+	}
+
+	c.record(method, time.Since(start), err, retries, hedges)
+	return out, err
+}
+
+type rpcResult struct {
+	out interface{}
+	err error
+}
+
+// attempt runs fn with the timeout of the method, when hedging is enabled and fn has not returned after the hedge
+// delay a second fn runs concurrently and the first success wins. It reports whether the call was hedged.
+func (c *schedulerClient) attempt(ctx context.Context, method string, fn func(ctx context.Context) (interface{}, error)) (interface{}, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.policy.timeoutOf(method))
+	defer cancel()
+
+	if c.policy.hedgeDelay <= 0 {
+		out, err := fn(ctx)
+		return out, false, err
+	}
+
+	// results is buffered so the losing call never blocks once the winner returned.
+	results := make(chan rpcResult, 2)
+	run := func() {
+		out, err := fn(ctx)
+		results <- rpcResult{out: out, err: err}
+	}
+
+	go run()
+
+	timer := time.NewTimer(c.policy.hedgeDelay)
+	defer timer.Stop()
+
+	select {
+	case result := <-results:
+		return result.out, false, result.err
+	case <-timer.C:
+	}
+
+	go run()
+
+	result := <-results
+	if result.err != nil {
+		// the first failure only decides when the other call fails too.
+		if second := <-results; second.err == nil {
+			result = second
+		}
+	}
+
+	return result.out, true, result.err
+}
+
+// isTransientRPCError tells whether a failed read is worth retrying: connection failures and attempts timing out
+// while the caller still waits are, errors returned by the scheduler are not.
+func isTransientRPCError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var connErr *jsonrpc.RPCConnectionError
+	if errors.As(err, &connErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func (c *schedulerClient) GetNodeInfo(ctx context.Context, nodeID string) (types.NodeInfo, error) {
+	out, err := c.read(ctx, "GetNodeInfo", func(ctx context.Context) (interface{}, error) {
+		return c.Scheduler.GetNodeInfo(ctx, nodeID)
+	})
+	if err != nil {
+		return types.NodeInfo{}, err
+	}
+	return out.(types.NodeInfo), nil
+}
+
+func (c *schedulerClient) GetProjectInfo(ctx context.Context, uuid string) (*types.ProjectInfo, error) {
+	out, err := c.read(ctx, "GetProjectInfo", func(ctx context.Context) (interface{}, error) {
+		return c.Scheduler.GetProjectInfo(ctx, uuid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.(*types.ProjectInfo), nil
+}
+
+func (c *schedulerClient) GetCurrentRegionInfos(ctx context.Context, areaID string) (map[string]int, error) {
+	out, err := c.read(ctx, "GetCurrentRegionInfos", func(ctx context.Context) (interface{}, error) {
+		return c.Scheduler.GetCurrentRegionInfos(ctx, areaID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.(map[string]int), nil
+}
+
+func (c *schedulerClient) GetNodesFromRegion(ctx context.Context, areaID string) ([]*types.NodeInfo, error) {
+	var out []*types.NodeInfo
+	err := c.call(ctx, "GetNodesFromRegion", func(ctx context.Context) error {
+		var err error
+		out, err = c.Scheduler.GetNodesFromRegion(ctx, areaID)
+		return err
+	})
+	return out, err
+}
+
+func (c *schedulerClient) GetTunserverURLFromUser(ctx context.Context, req *types.TunserverReq) (*types.TunserverRsp, error) {
+	var out *types.TunserverRsp
+	err := c.call(ctx, "GetTunserverURLFromUser", func(ctx context.Context) error {
+		var err error
+		out, err = c.Scheduler.GetTunserverURLFromUser(ctx, req)
+		return err
+	})
+	return out, err
+}
+
+func (c *schedulerClient) DeployProject(ctx context.Context, req *types.DeployProjectReq) error {
+	return c.call(ctx, "DeployProject", func(ctx context.Context) error {
+		return c.Scheduler.DeployProject(ctx, req)
+	})
+}
+
+func (c *schedulerClient) UpdateProject(ctx context.Context, req *types.ProjectReq) error {
+	return c.call(ctx, "UpdateProject", func(ctx context.Context) error {
+		return c.Scheduler.UpdateProject(ctx, req)
+	})
+}
+
+func (c *schedulerClient) DeleteProject(ctx context.Context, req *types.ProjectReq) error {
+	return c.call(ctx, "DeleteProject", func(ctx context.Context) error {
+		return c.Scheduler.DeleteProject(ctx, req)
+	})
+}
+
+// GetSchedulerRPCMetricsHandler lists the call counters of every scheduler by method.
+func GetSchedulerRPCMetricsHandler(c *gin.Context) {
+	var out []*SchedulerRPCMetrics
+	for _, scheduler := range GlobalServer.GetSchedulers() {
+		if client, ok := scheduler.Api.(*schedulerClient); ok {
+			out = append(out, client.getMetrics()...)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AreaId != out[j].AreaId {
+			return out[i].AreaId < out[j].AreaId
+		}
+		if out[i].Url != out[j].Url {
+			return out[i].Url < out[j].Url
+		}
+		return out[i].Method < out[j].Method
+	})
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  out,
+		"total": len(out),
+	}))
+}
@@ -0,0 +1,346 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/gnasnik/titan-workerd-api/config"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"math/rand"
+	"strings"
+)
+
+const (
+	SelectorNearest     = "nearest"
+	SelectorScored      = "scored"
+	SelectorPrefix      = "prefix"
+	SelectorLeastLoaded = "least-loaded"
+	SelectorRandom      = "random"
+	SelectorPin         = "pin"
+)
+
+var defaultSelectorChain = []string{SelectorPin, SelectorPrefix, SelectorScored, SelectorNearest, SelectorRandom}
+
+// SelectRequest is what a SchedulerSelector knows about the deployment it selects a scheduler for.
+type SelectRequest struct {
+	ClientIP string
+	// AreaID is the area asked for, it is used by the prefix and pin selectors.
+	AreaID string
+	Region string
+}
+
+// SchedulerSelector picks one of the available schedulers, it returns errors.ErrNoAvailableScheduler when none fits.
+type SchedulerSelector interface {
+	Name() string
+	Select(ctx context.Context, schedulers []*Scheduler, req *SelectRequest) (*Scheduler, error)
+}
+
+type nearestSelector struct{}
+
+// Select picks the scheduler geographically closest to the client.
+func (nearestSelector) Select(ctx context.Context, schedulers []*Scheduler, req *SelectRequest) (*Scheduler, error) {
+	if req.ClientIP == "" || len(schedulers) == 0 {
+		return nil, errors.ErrNoAvailableScheduler
+	}
+
+	var schedulerIPs []string
+	for _, s := range schedulers {
+		schedulerIPs = append(schedulerIPs, s.IP)
+	}
+
+	result, err := GetUserNearestIP(ctx, req.ClientIP, schedulerIPs, NewIPCoordinate())
+	if err != nil {
+		log.Errorf("get nearest ip: %v", err)
+		return nil, err
+	}
+
+	for _, scheduler := range schedulers {
+		if scheduler.IP == result {
+			return scheduler, nil
+		}
+	}
+
+	return nil, errors.ErrNoAvailableScheduler
+}
+
+func (nearestSelector) Name() string { return SelectorNearest }
+
+type prefixSelector struct{}
+
+// Select picks the scheduler whose area shares the longest prefix with the requested area.
+func (prefixSelector) Select(ctx context.Context, schedulers []*Scheduler, req *SelectRequest) (*Scheduler, error) {
+	if req.AreaID == "" {
+		return nil, errors.ErrNoAvailableScheduler
+	}
+
+	var areaIds []string
+	for _, scheduler := range schedulers {
+		areaIds = append(areaIds, scheduler.AreaId)
+	}
+
+	maybeBest := findBestMatch(areaIds, req.AreaID)
+
+	return findSchedulerByAreaId(schedulers, maybeBest)
+}
+
+func (prefixSelector) Name() string { return SelectorPrefix }
+
+type leastLoadedSelector struct{}
+
+// Select picks the scheduler with the most available nodes in the requested region.
+func (leastLoadedSelector) Select(ctx context.Context, schedulers []*Scheduler, req *SelectRequest) (*Scheduler, error) {
+	var (
+		best      *Scheduler
+		bestNodes int
+	)
+
+	for _, scheduler := range schedulers {
+		capacity, err := GlobalServer.capacity.get(ctx, scheduler)
+		if err != nil {
+			log.Errorf("least loaded selector: %s: %v", scheduler.AreaId, err)
+			continue
+		}
+
+		nodes := availableNodes(capacity, req.Region)
+
+		if nodes > bestNodes {
+			best, bestNodes = scheduler, nodes
+		}
+	}
+
+	if best == nil {
+		return nil, errors.ErrNoAvailableScheduler
+	}
+
+	return best, nil
+}
+
+func (leastLoadedSelector) Name() string { return SelectorLeastLoaded }
+
+type weightedRandomSelector struct {
+	// whitelist restricts the choice to these areas when any of them is available.
+	whitelist []string
+	// weights of the areas, areas without a weight count as 1.
+	weights map[string]int
+}
+
+// Select picks a random scheduler, with a chance proportional to the weight of its area.
+func (s *weightedRandomSelector) Select(ctx context.Context, schedulers []*Scheduler, req *SelectRequest) (*Scheduler, error) {
+	candidates := schedulers
+
+	if len(s.whitelist) > 0 {
+		var whitelisted []*Scheduler
+		for _, scheduler := range schedulers {
+			if containsString(s.whitelist, scheduler.AreaId) {
+				whitelisted = append(whitelisted, scheduler)
+			}
+		}
+
+		if len(whitelisted) > 0 {
+			candidates = whitelisted
+		}
+	}
+
+	var total int
+	for _, scheduler := range candidates {
+		total += s.weight(scheduler.AreaId)
+	}
+
+	// every candidate may be weighted out.
+	if total <= 0 {
+		return nil, errors.ErrNoAvailableScheduler
+	}
+
+	n := rand.Intn(total)
+	for _, scheduler := range candidates {
+		n -= s.weight(scheduler.AreaId)
+		if n < 0 {
+			return scheduler, nil
+		}
+	}
+
+	return nil, errors.ErrNoAvailableScheduler
+}
+
+func (s *weightedRandomSelector) weight(areaId string) int {
+	if w, ok := s.weights[areaId]; ok {
+		return w
+	}
+	return 1
+}
+
+func (s *weightedRandomSelector) Name() string { return SelectorRandom }
+
+type pinSelector struct {
+	// areaId is the pinned area, the requested area is used when it is empty.
+	areaId string
+}
+
+// Select picks the scheduler of the pinned area only.
+func (s pinSelector) Select(ctx context.Context, schedulers []*Scheduler, req *SelectRequest) (*Scheduler, error) {
+	areaId := s.areaId
+	if areaId == "" {
+		areaId = req.AreaID
+	}
+
+	if areaId == "" {
+		return nil, errors.ErrNoAvailableScheduler
+	}
+
+	return findSchedulerByAreaId(schedulers, areaId)
+}
+
+func (s pinSelector) Name() string {
+	if s.areaId == "" {
+		return SelectorPin
+	}
+	return SelectorPin + ":" + s.areaId
+}
+
+func findSchedulerByAreaId(schedulers []*Scheduler, areaId string) (*Scheduler, error) {
+	for _, scheduler := range schedulers {
+		if scheduler.AreaId == areaId {
+			return scheduler, nil
+		}
+	}
+
+	return nil, errors.ErrNoAvailableScheduler
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// selectorChain tries its selectors in order and returns the first scheduler found.
+type selectorChain []SchedulerSelector
+
+func (chain selectorChain) Names() []string {
+	var out []string
+	for _, selector := range chain {
+		out = append(out, selector.Name())
+	}
+	return out
+}
+
+// Select returns the scheduler and the name of the selector which picked it.
+func (chain selectorChain) Select(ctx context.Context, schedulers []*Scheduler, req *SelectRequest) (*Scheduler, string, error) {
+	for _, selector := range chain {
+		scheduler, err := selector.Select(ctx, schedulers, req)
+		if err == nil && scheduler != nil {
+			return scheduler, selector.Name(), nil
+		}
+
+		if err != nil && err != errors.ErrNoAvailableScheduler {
+			log.Warnf("selector %s: %v", selector.Name(), err)
+		}
+	}
+
+	return nil, "", errors.ErrNoAvailableScheduler
+}
+
+// selectorRegistry builds the selector chains from the config.
+type selectorRegistry struct {
+	random *weightedRandomSelector
+	chain  selectorChain
+	users  map[string]selectorChain
+}
+
+func newSelectorRegistry(cfg config.SelectorConfig) (*selectorRegistry, error) {
+	r := &selectorRegistry{
+		random: &weightedRandomSelector{
+			whitelist: cfg.Whitelist,
+			weights:   make(map[string]int),
+		},
+		users: make(map[string]selectorChain),
+	}
+
+	for _, w := range cfg.Weights {
+		if w.Weight < 0 {
+			return nil, fmt.Errorf("negative selector weight %d for area %s", w.Weight, w.AreaID)
+		}
+		r.random.weights[w.AreaID] = w.Weight
+	}
+
+	names := cfg.Chain
+	if len(names) == 0 {
+		names = defaultSelectorChain
+	}
+
+	chain, err := r.parseChain(names)
+	if err != nil {
+		return nil, err
+	}
+	r.chain = chain
+
+	for _, user := range cfg.Users {
+		chain, err := r.parseChain(user.Chain)
+		if err != nil {
+			return nil, fmt.Errorf("selector chain of %s: %w", user.Username, err)
+		}
+		r.users[user.Username] = chain
+	}
+
+	return r, nil
+}
+
+// parseChain turns selector names into a chain, "pin:<area id>" pins an area.
+func (r *selectorRegistry) parseChain(names []string) (selectorChain, error) {
+	var chain selectorChain
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+
+		switch {
+		case name == SelectorNearest:
+			chain = append(chain, nearestSelector{})
+		case name == SelectorScored:
+			chain = append(chain, scoredSelector{})
+		case name == SelectorPrefix:
+			chain = append(chain, prefixSelector{})
+		case name == SelectorLeastLoaded:
+			chain = append(chain, leastLoadedSelector{})
+		case name == SelectorRandom:
+			chain = append(chain, r.random)
+		case name == SelectorPin:
+			chain = append(chain, pinSelector{})
+		case strings.HasPrefix(name, SelectorPin+":"):
+			chain = append(chain, pinSelector{areaId: strings.TrimPrefix(name, SelectorPin+":")})
+		default:
+			return nil, fmt.Errorf("unknown selector %q", name)
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("empty selector chain")
+	}
+
+	return chain, nil
+}
+
+// chainFor returns the chain of the request when given as comma separated selector names, else the chain configured
+// for the user, else the default chain.
+func (r *selectorRegistry) chainFor(username, selectors string) (selectorChain, error) {
+	if selectors != "" {
+		return r.parseChain(strings.Split(selectors, ","))
+	}
+
+	if chain, ok := r.users[username]; ok {
+		return chain, nil
+	}
+
+	return r.chain, nil
+}
+
+// selectScheduler picks an available scheduler with the chain of the request or of the user.
+func selectScheduler(ctx context.Context, username, selectors string, req *SelectRequest) (*Scheduler, string, error) {
+	chain, err := GlobalServer.selectors.chainFor(username, selectors)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return chain.Select(ctx, GlobalServer.GetSelectableSchedulers(), req)
+}
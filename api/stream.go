@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	streamKeepAlive = 15 * time.Second
+	// streamAccessTTL is how long an access decision of a stream is trusted, revoked access stops streaming after it.
+	streamAccessTTL = 30 * time.Second
+)
+
+type streamAccess struct {
+	allowed   bool
+	checkedAt time.Time
+}
+
+// statusPoller polls the schedulers for the state of the projects watched by stream subscribers and publishes the
+// changes on the event bus, so the dashboards no longer need to poll the project list.
+type statusPoller struct {
+	interval time.Duration
+	bus      *eventBus
+
+	// states is the last state seen per project.
+	states map[string]string
+}
+
+func newStatusPoller(interval time.Duration, bus *eventBus) *statusPoller {
+	return &statusPoller{
+		interval: interval,
+		bus:      bus,
+		states:   make(map[string]string),
+	}
+}
+
+func (sp *statusPoller) run(ctx context.Context) {
+	if sp.interval <= 0 {
+		log.Infof("status poller disabled")
+		return
+	}
+
+	ticker := time.NewTicker(sp.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sp.pollOnce(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (sp *statusPoller) pollOnce(ctx context.Context) {
+	states := make(map[string]string)
+
+	for _, sub := range sp.bus.workspaces() {
+		projects, err := dao.GetWorkspaceProjects(ctx, dao.QueryOption{UserID: sub.Username, OrgID: sub.Workspace})
+		if err != nil {
+			log.Errorf("status poller: get projects: %v", err)
+			continue
+		}
+
+		for _, project := range projects {
+			if _, ok := states[project.ProjectID]; ok {
+				continue
+			}
+
+			state, err := getProjectState(ctx, project)
+			if err != nil {
+				log.Errorf("status poller: project %s: %v", project.ProjectID, err)
+				continue
+			}
+
+			states[project.ProjectID] = state
+
+			if last, ok := sp.states[project.ProjectID]; ok && last == state {
+				continue
+			}
+
+			sp.bus.publish(&ProjectEvent{
+				Type:      ProjectEventStatus,
+				ProjectID: project.ProjectID,
+				UserID:    project.UserID,
+				OrgID:     project.OrgID,
+				Name:      project.Name,
+				Status:    state,
+			})
+		}
+	}
+
+	// projects no longer watched are forgotten, their state is published again once watched.
+	sp.states = states
+}
+
+// getProjectState returns the state reported by the scheduler of the first area of the project.
+func getProjectState(ctx context.Context, project *model.Project) (string, error) {
+	placements, err := getProjectPlacements(ctx, project)
+	if err != nil {
+		return "", err
+	}
+
+	if len(placements) == 0 {
+		return "", nil
+	}
+
+	scheduler, err := GetSchedulerByAreaId(placements[0].AreaID)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := scheduler.Api.GetProjectInfo(ctx, project.ProjectID)
+	if err != nil {
+		return "", err
+	}
+
+	return info.State, nil
+}
+
+// StreamProjectsHandler streams the state changes and the deploy progress of the projects of the workspace of the
+// user as server-sent events.
+func StreamProjectsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	workspace := getWorkspace(c)
+	if workspace != "" {
+		if _, err := authorizeOrg(c.Request.Context(), username, workspace, model.ProjectRoleViewer); err != nil {
+			c.JSON(http.StatusOK, respError(err))
+			return
+		}
+	}
+
+	sub := GlobalServer.bus.subscribe(username, workspace)
+	defer GlobalServer.bus.unsubscribe(sub)
+
+	refreshShared := func() {
+		if workspace != "" {
+			return
+		}
+
+		projectIds, err := dao.GetGrantedProjectIds(c.Request.Context(), username)
+		if err != nil {
+			log.Errorf("stream: get granted projects: %v", err)
+			return
+		}
+		sub.setShared(projectIds)
+	}
+	refreshShared()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	accessExpiry := time.NewTicker(streamAccessTTL)
+	defer accessExpiry.Stop()
+
+	// the access of the user to a project is checked again once the decision is older than streamAccessTTL.
+	access := make(map[string]*streamAccess)
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-sub.C:
+			decision, ok := access[event.ProjectID]
+			if !ok || time.Since(decision.checkedAt) >= streamAccessTTL {
+				decision = &streamAccess{
+					allowed:   canViewProject(c.Request.Context(), username, event),
+					checkedAt: time.Now(),
+				}
+				access[event.ProjectID] = decision
+			}
+
+			if decision.allowed {
+				c.SSEvent(event.Type, event)
+			}
+			return true
+		case <-accessExpiry.C:
+			refreshShared()
+			return true
+		case <-keepAlive.C:
+			c.SSEvent("ping", JsonObject{"time": time.Now()})
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func canViewProject(ctx context.Context, username string, event *ProjectEvent) bool {
+	if event.OrgID == "" && event.UserID == username {
+		return true
+	}
+
+	project := &model.Project{ProjectID: event.ProjectID, UserID: event.UserID, OrgID: event.OrgID}
+	return getProjectRole(ctx, project, username) != ""
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// applyProjectTemplate fills the fields of the request left empty from the template, users can instantiate their
+// own templates and the templates published by admins.
+func applyProjectTemplate(ctx context.Context, username string, params *DeployReq) error {
+	template, err := dao.GetProjectTemplateById(ctx, params.TemplateID)
+	if err != nil {
+		return errors.ErrNotFound
+	}
+
+	if !template.Published && template.UserID != username {
+		return errors.ErrNotFound
+	}
+
+	if params.Name == "" {
+		params.Name = template.Name
+	}
+
+	if params.BundleUrl == "" {
+		params.BundleUrl = template.BundleUrl
+	}
+
+	if params.Replicas == 0 && len(params.ReplicaSpread) == 0 {
+		params.Replicas = template.Replicas
+	}
+
+	if params.CpuCores == 0 {
+		params.CpuCores = template.CpuCores
+	}
+
+	if params.Memory == 0 {
+		params.Memory = template.Memory
+	}
+
+	if params.Version == 0 {
+		params.Version = template.Version
+	}
+
+	if params.Description == "" {
+		params.Description = template.Description
+	}
+
+	return nil
+}
+
+type CreateTemplateReq struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	BundleUrl   string `json:"bundle_url" binding:"required"`
+	Replicas    int64  `json:"replicas"`
+	CpuCores    int32  `json:"cpu_cores"`
+	Memory      int64  `json:"memory"`
+	Version     int64  `json:"version"`
+}
+
+func CreateTemplateHandler(c *gin.Context) {
+	createTemplate(c, false)
+}
+
+// PublishTemplateHandler creates a template every user can instantiate.
+func PublishTemplateHandler(c *gin.Context) {
+	createTemplate(c, true)
+}
+
+func createTemplate(c *gin.Context, published bool) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params CreateTemplateReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	template := &model.ProjectTemplate{
+		TemplateID:  uuid.NewString(),
+		UserID:      username,
+		Name:        params.Name,
+		Description: params.Description,
+		BundleUrl:   params.BundleUrl,
+		Replicas:    params.Replicas,
+		CpuCores:    params.CpuCores,
+		Memory:      params.Memory,
+		Version:     params.Version,
+		Published:   published,
+	}
+
+	if err := dao.AddProjectTemplate(c.Request.Context(), template); err != nil {
+		log.Errorf("add project template: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(template))
+}
+
+func GetTemplatesHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	templates, err := dao.GetProjectTemplates(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("get project templates: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": templates,
+	}))
+}
+
+type DeleteTemplateReq struct {
+	TemplateID string `json:"template_id" binding:"required"`
+}
+
+// DeleteTemplateHandler deletes a template of the user, published templates can only be deleted by admins.
+func DeleteTemplateHandler(c *gin.Context) {
+	deleteTemplate(c, false)
+}
+
+// AdminDeleteTemplateHandler deletes any template, published or not.
+func AdminDeleteTemplateHandler(c *gin.Context) {
+	deleteTemplate(c, true)
+}
+
+func deleteTemplate(c *gin.Context, admin bool) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params DeleteTemplateReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	template, err := dao.GetProjectTemplateById(c.Request.Context(), params.TemplateID)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrNotFound))
+		return
+	}
+
+	if !admin && (template.Published || template.UserID != username) {
+		c.JSON(http.StatusOK, respError(errors.ErrPermissionNotAllowed))
+		return
+	}
+
+	if err = dao.DeleteProjectTemplate(c.Request.Context(), template.TemplateID); err != nil {
+		log.Errorf("delete project template: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// streamTicketTTL is how long a stream ticket can be redeemed after it was issued.
+const streamTicketTTL = 30 * time.Second
+
+// streamTicket stands in for the token on the stream endpoints: clients like EventSource can not set headers and
+// the query ends up in the access logs, so they exchange their token for a ticket which is short-lived and can only
+// be redeemed once.
+type streamTicket struct {
+	username  string
+	workspace string
+	expireAt  time.Time
+}
+
+type streamTicketStore struct {
+	mu      sync.Mutex
+	tickets map[string]*streamTicket
+}
+
+var streamTickets = &streamTicketStore{tickets: make(map[string]*streamTicket)}
+
+func (s *streamTicketStore) issue(username, workspace string) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+
+	id := hex.EncodeToString(b)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the tickets never redeemed are dropped as new ones are issued.
+	for key, ticket := range s.tickets {
+		if now.After(ticket.expireAt) {
+			delete(s.tickets, key)
+		}
+	}
+
+	ticket := &streamTicket{username: username, workspace: workspace, expireAt: now.Add(streamTicketTTL)}
+	s.tickets[id] = ticket
+
+	return id, ticket.expireAt, nil
+}
+
+// redeem returns the ticket and forgets it, so it can not be replayed from the logs.
+func (s *streamTicketStore) redeem(id string) (*streamTicket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ticket, ok := s.tickets[id]
+	if !ok {
+		return nil, false
+	}
+	delete(s.tickets, id)
+
+	if time.Now().After(ticket.expireAt) {
+		return nil, false
+	}
+
+	return ticket, true
+}
+
+type streamTicketResponse struct {
+	Ticket string `json:"ticket"`
+	Expire string `json:"expire"`
+}
+
+// CreateStreamTicketHandler issues a ticket to open a stream with, in the workspace of the token.
+func CreateStreamTicketHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	ticket, expire, err := streamTickets.issue(username, getWorkspace(c))
+	if err != nil {
+		log.Errorf("issue stream ticket: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(streamTicketResponse{
+		Ticket: ticket,
+		Expire: expire.Format(time.RFC3339),
+	}))
+}
+
+// StreamAuthMiddleware authenticates the stream requests by the ticket in the query, the requests without ticket
+// go through the token middleware.
+func StreamAuthMiddleware(mw *jwt.GinJWTMiddleware) gin.HandlerFunc {
+	tokenAuth := mw.MiddlewareFunc()
+
+	return func(c *gin.Context) {
+		id := c.Query("ticket")
+		if id == "" {
+			tokenAuth(c)
+			return
+		}
+
+		ticket, ok := streamTickets.redeem(id)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"code":    http.StatusUnauthorized,
+				"message": "invalid or expired stream ticket",
+				"success": false,
+			})
+			return
+		}
+
+		// the claims are set the way the token middleware does, so the handlers read them alike.
+		c.Set("JWT_PAYLOAD", jwt.MapClaims{
+			identityKey:  ticket.username,
+			workspaceKey: ticket.workspace,
+		})
+		c.Set(identityKey, &model.User{Username: ticket.username})
+		c.Next()
+	}
+}
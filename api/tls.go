@@ -0,0 +1,136 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/gnasnik/titan-workerd-api/config"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// schedulerTransport builds the http clients of the scheduler rpc connections: https schedulers are verified
+// against the configured CA bundle and get the client certificate, plain http is refused unless the area of the
+// scheduler opted in.
+type schedulerTransport struct {
+	defaults *tls.Config
+	// byURL and byArea are the tls configs of the overrides, an url override wins over an area override.
+	byURL         map[string]*tls.Config
+	byArea        map[string]*tls.Config
+	insecureAreas map[string]bool
+}
+
+func newSchedulerTransport(cfg config.SchedulerTLSConfig) (*schedulerTransport, error) {
+	defaults, err := newTLSConfig(cfg.CAFile, cfg.CertFile, cfg.KeyFile, cfg.ServerName, cfg.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &schedulerTransport{
+		defaults:      defaults,
+		byURL:         make(map[string]*tls.Config),
+		byArea:        make(map[string]*tls.Config),
+		insecureAreas: make(map[string]bool),
+	}
+
+	for _, areaId := range cfg.InsecureAreas {
+		t.insecureAreas[areaId] = true
+	}
+
+	for _, override := range cfg.Overrides {
+		if override.URL == "" && override.AreaID == "" {
+			return nil, fmt.Errorf("scheduler tls override without url or area")
+		}
+
+		// the fields left empty in the override fall back to the defaults.
+		caFile, certFile, keyFile, serverName := override.CAFile, override.CertFile, override.KeyFile, override.ServerName
+		if caFile == "" {
+			caFile = cfg.CAFile
+		}
+		if certFile == "" && keyFile == "" {
+			certFile, keyFile = cfg.CertFile, cfg.KeyFile
+		}
+		if serverName == "" {
+			serverName = cfg.ServerName
+		}
+
+		tlsConfig, err := newTLSConfig(caFile, certFile, keyFile, serverName, cfg.InsecureSkipVerify || override.InsecureSkipVerify)
+		if err != nil {
+			return nil, fmt.Errorf("scheduler tls override %s%s: %w", override.URL, override.AreaID, err)
+		}
+
+		if override.URL != "" {
+			t.byURL[override.URL] = tlsConfig
+		} else {
+			t.byArea[override.AreaID] = tlsConfig
+		}
+	}
+
+	return t, nil
+}
+
+func newTLSConfig(caFile, certFile, keyFile, serverName string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         serverName,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	// the system pool is used when no CA bundle is given.
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// httpClient returns the http client to reach the scheduler with.
+func (t *schedulerTransport) httpClient(cfg types.SchedulerCfg) (*http.Client, error) {
+	sUrl, err := url.Parse(cfg.SchedulerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch sUrl.Scheme {
+	case "https":
+	case "http":
+		if !t.insecureAreas[cfg.AreaID] {
+			return nil, fmt.Errorf("plain http is not allowed for the schedulers of area %s", cfg.AreaID)
+		}
+		return &http.Client{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported scheduler url scheme %q", sUrl.Scheme)
+	}
+
+	tlsConfig, ok := t.byURL[cfg.SchedulerURL]
+	if !ok {
+		tlsConfig, ok = t.byArea[cfg.AreaID]
+	}
+	if !ok {
+		tlsConfig = t.defaults
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig.Clone()
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,642 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-workerd-api/config"
+	"github.com/gnasnik/titan-workerd-api/core/dao"
+	"github.com/gnasnik/titan-workerd-api/core/errors"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"github.com/google/uuid"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	webhookBatchSize   = 100
+	webhookConcurrency = 8
+	maxWebhookBackoff  = 6 * time.Hour
+)
+
+const (
+	defaultWebhookMaxAttempts = 8
+	defaultWebhookBackoff     = 30 * time.Second
+	defaultWebhookTimeout     = 10 * time.Second
+)
+
+const (
+	WebhookHeaderEvent     = "X-Webhook-Event"
+	WebhookHeaderDelivery  = "X-Webhook-Delivery"
+	WebhookHeaderSignature = "X-Webhook-Signature"
+)
+
+var webhookEvents = map[string]bool{
+	model.EventProjectCreated:  true,
+	model.EventProjectDeployed: true,
+	model.EventProjectFailed:   true,
+	model.EventProjectExpired:  true,
+	model.EventProjectDeleted:  true,
+	model.EventQuotaWarning:    true,
+}
+
+// WebhookPayload is the body posted to the webhook endpoints.
+type WebhookPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// webhookDispatcher posts the pending deliveries and retries the failed ones with an exponential backoff, deliveries
+// still failing after MaxAttempts are kept as dead letters.
+type webhookDispatcher struct {
+	interval    time.Duration
+	maxAttempts int64
+	backoff     time.Duration
+	client      *http.Client
+	// allowPrivate lets the webhooks reach loopback, private and link-local addresses.
+	allowPrivate bool
+
+	wake chan struct{}
+
+	// lastExpiryScan is the end of the window of the last scan for expired projects.
+	lastExpiryScan time.Time
+}
+
+func newWebhookDispatcher(cfg config.WebhookConfig) *webhookDispatcher {
+	wd := &webhookDispatcher{
+		interval:       cfg.Interval,
+		maxAttempts:    cfg.MaxAttempts,
+		backoff:        cfg.Backoff,
+		allowPrivate:   cfg.AllowPrivateNetworks,
+		wake:           make(chan struct{}, 1),
+		lastExpiryScan: time.Now(),
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	wd.client = newWebhookClient(timeout, wd.allowPrivate)
+
+	if wd.maxAttempts <= 0 {
+		wd.maxAttempts = defaultWebhookMaxAttempts
+	}
+
+	if wd.backoff <= 0 {
+		wd.backoff = defaultWebhookBackoff
+	}
+
+	return wd
+}
+
+func (wd *webhookDispatcher) run(ctx context.Context) {
+	if wd.interval <= 0 {
+		log.Infof("webhook dispatcher disabled")
+		return
+	}
+
+	ticker := time.NewTicker(wd.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			wd.scanExpiredProjects(ctx)
+		case <-wd.wake:
+		case <-ctx.Done():
+			return
+		}
+
+		wd.dispatchOnce(ctx)
+	}
+}
+
+func (wd *webhookDispatcher) notify() {
+	select {
+	case wd.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (wd *webhookDispatcher) scanExpiredProjects(ctx context.Context) {
+	now := time.Now()
+
+	projects, err := dao.GetProjectsExpiredBetween(ctx, wd.lastExpiryScan, now)
+	if err != nil {
+		log.Errorf("webhook: get expired projects: %v", err)
+		return
+	}
+
+	wd.lastExpiryScan = now
+
+	for _, project := range projects {
+		notifyEvent(ctx, project.UserID, model.EventProjectExpired, JsonObject{"project": project})
+	}
+}
+
+func (wd *webhookDispatcher) dispatchOnce(ctx context.Context) {
+	deliveries, err := dao.GetDueWebhookDeliveries(ctx, time.Now(), webhookBatchSize)
+	if err != nil {
+		log.Errorf("webhook: get deliveries: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, webhookConcurrency)
+
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(delivery *model.WebhookDelivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := wd.deliver(ctx, delivery); err != nil {
+				log.Errorf("webhook: delivery %s: %v", delivery.DeliveryID, err)
+			}
+		}(delivery)
+	}
+
+	wg.Wait()
+}
+
+func (wd *webhookDispatcher) deliver(ctx context.Context, delivery *model.WebhookDelivery) error {
+	delivery.Attempts++
+
+	webhook, err := dao.GetWebhookById(ctx, delivery.WebhookID)
+	if err != nil {
+		delivery.Status = model.DeliveryStatusDead
+		delivery.Error = "webhook not found"
+		return dao.UpdateWebhookDelivery(ctx, delivery)
+	}
+
+	wd.attempt(ctx, webhook, delivery)
+
+	return dao.UpdateWebhookDelivery(ctx, delivery)
+}
+
+// attempt sends the delivery and settles it: delivered on success, dead after the last attempt, or scheduled for
+// a retry after the backoff.
+func (wd *webhookDispatcher) attempt(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) {
+	statusCode, err := wd.send(ctx, webhook, delivery)
+	delivery.StatusCode = int64(statusCode)
+	delivery.Error = ""
+
+	switch {
+	case err == nil:
+		delivery.Status = model.DeliveryStatusDelivered
+	case delivery.Attempts >= wd.maxAttempts:
+		delivery.Status = model.DeliveryStatusDead
+		delivery.Error = err.Error()
+	default:
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = time.Now().Add(wd.backoffDelay(delivery.Attempts))
+	}
+}
+
+// backoffDelay returns the delay before the next attempt, doubling after every failed attempt.
+func (wd *webhookDispatcher) backoffDelay(attempts int64) time.Duration {
+	delay := wd.backoff
+	for i := int64(1); i < attempts && delay < maxWebhookBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxWebhookBackoff {
+		delay = maxWebhookBackoff
+	}
+
+	return delay
+}
+
+// send posts the payload of the delivery signed with the secret of the webhook, any 2xx status is a success.
+func (wd *webhookDispatcher) send(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookHeaderEvent, delivery.Event)
+	req.Header.Set(WebhookHeaderDelivery, delivery.DeliveryID)
+	req.Header.Set(WebhookHeaderSignature, signWebhookPayload(webhook.Secret, body))
+
+	resp, err := wd.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// newWebhookClient returns the client posting the deliveries, it does not follow redirects and, unless
+// allowPrivate, refuses to connect to an address which is not public. The address is checked when dialing so a
+// host resolving to a public address at creation and a private one later is refused too.
+func newWebhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("webhook address %s is not public", host)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, not covered by net.IP.IsPrivate.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// checkWebhookURL makes sure the url is an http(s) url whose host only resolves to public addresses.
+func (wd *webhookDispatcher) checkWebhookURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url: %s", rawURL)
+	}
+
+	if wd.allowPrivate {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("resolve %s: %v", u.Hostname(), err)
+	}
+
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return fmt.Errorf("url %s resolves to the non public address %s", rawURL, addr.IP)
+		}
+	}
+
+	return nil
+}
+
+// signWebhookPayload returns the `sha256=<hex>` HMAC of the body, receivers recompute it with the shared secret.
+func signWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func subscribesTo(webhook *model.Webhook, event string) bool {
+	if webhook.Events == "" {
+		return true
+	}
+
+	for _, e := range strings.Split(webhook.Events, ",") {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newWebhookDelivery(webhookId, event string, data interface{}) (*model.WebhookDelivery, error) {
+	payload := &WebhookPayload{
+		ID:        uuid.NewString(),
+		Event:     event,
+		CreatedAt: time.Now(),
+		Data:      data,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.WebhookDelivery{
+		DeliveryID:    payload.ID,
+		WebhookID:     webhookId,
+		Event:         event,
+		Payload:       string(body),
+		Status:        model.DeliveryStatusPending,
+		NextAttemptAt: payload.CreatedAt,
+	}, nil
+}
+
+// notifyEvent queues a delivery of the event for every webhook of the user subscribed to it.
+func notifyEvent(ctx context.Context, userId, event string, data interface{}) {
+	if GlobalServer == nil || GlobalServer.webhooks == nil {
+		return
+	}
+
+	webhooks, err := dao.GetWebhooksByUserId(ctx, userId)
+	if err != nil {
+		log.Errorf("webhook: get webhooks: %v", err)
+		return
+	}
+
+	var queued bool
+	for _, webhook := range webhooks {
+		if !webhook.Enabled || !subscribesTo(webhook, event) {
+			continue
+		}
+
+		delivery, err := newWebhookDelivery(webhook.WebhookID, event, data)
+		if err != nil {
+			log.Errorf("webhook: new delivery: %v", err)
+			continue
+		}
+
+		if err = dao.AddWebhookDelivery(ctx, delivery); err != nil {
+			log.Errorf("webhook: add delivery: %v", err)
+			continue
+		}
+
+		queued = true
+	}
+
+	if queued {
+		GlobalServer.webhooks.notify()
+	}
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type CreateWebhookReq struct {
+	Url string `json:"url" binding:"required"`
+	// Events the webhook subscribes to, every event when empty.
+	Events []string `json:"events"`
+	// Secret signs the payloads, a random secret is generated when empty.
+	Secret string `json:"secret"`
+}
+
+func CreateWebhookHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params CreateWebhookReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	err := GlobalServer.webhooks.checkWebhookURL(c.Request.Context(), params.Url)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	for _, event := range params.Events {
+		if !webhookEvents[event] {
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInvalidParams, "unsupported event: "+event))
+			return
+		}
+	}
+
+	secret := params.Secret
+	if secret == "" {
+		if secret, err = newWebhookSecret(); err != nil {
+			c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+			return
+		}
+	}
+
+	webhook := &model.Webhook{
+		WebhookID: uuid.NewString(),
+		UserID:    username,
+		Url:       params.Url,
+		Secret:    secret,
+		Events:    strings.Join(params.Events, ","),
+		Enabled:   true,
+	}
+
+	if err = dao.AddWebhook(c.Request.Context(), webhook); err != nil {
+		log.Errorf("add webhook: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	// the secret is only returned once.
+	c.JSON(http.StatusOK, respJSON(webhook))
+}
+
+func GetWebhooksHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	webhooks, err := dao.GetWebhooksByUserId(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("get webhooks: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": webhooks,
+	}))
+}
+
+// getUserWebhook loads the webhook and makes sure it belongs to the user.
+func getUserWebhook(ctx context.Context, username, webhookId string) (*model.Webhook, error) {
+	webhook, err := dao.GetWebhookById(ctx, webhookId)
+	if err != nil || webhook.UserID != username {
+		return nil, errors.ErrNotFound
+	}
+	return webhook, nil
+}
+
+type WebhookReq struct {
+	WebhookID string `json:"webhook_id" binding:"required"`
+}
+
+func DeleteWebhookHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params WebhookReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	webhook, err := getUserWebhook(c.Request.Context(), username, params.WebhookID)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	if err = dao.DeleteWebhook(c.Request.Context(), webhook.WebhookID); err != nil {
+		log.Errorf("delete webhook: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	if err = dao.DeleteWebhookDeliveries(c.Request.Context(), webhook.WebhookID); err != nil {
+		log.Errorf("delete webhook deliveries: %v", err)
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+// TestWebhookHandler posts a ping event to the webhook right away and reports the result, it is not retried.
+func TestWebhookHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params WebhookReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	webhook, err := getUserWebhook(c.Request.Context(), username, params.WebhookID)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	delivery, err := newWebhookDelivery(webhook.WebhookID, model.EventPing, JsonObject{"webhook_id": webhook.WebhookID})
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	statusCode, err := GlobalServer.webhooks.send(c.Request.Context(), webhook, delivery)
+
+	delivery.Attempts = 1
+	delivery.StatusCode = int64(statusCode)
+	delivery.Status = model.DeliveryStatusDelivered
+	if err != nil {
+		delivery.Status = model.DeliveryStatusDead
+		delivery.Error = err.Error()
+	}
+
+	if err = dao.AddWebhookDelivery(c.Request.Context(), delivery); err != nil {
+		log.Errorf("add webhook delivery: %v", err)
+	}
+
+	c.JSON(http.StatusOK, respJSON(delivery))
+}
+
+// GetWebhookDeliveriesHandler lists the deliveries of the webhook, `status=dead` lists the dead letters.
+func GetWebhookDeliveriesHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	page, _ := strconv.ParseInt(c.Query("page"), 10, 64)
+	size, _ := strconv.ParseInt(c.Query("size"), 10, 64)
+
+	webhook, err := getUserWebhook(c.Request.Context(), username, c.Query("webhook_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	total, deliveries, err := dao.GetWebhookDeliveries(c.Request.Context(), webhook.WebhookID, c.Query("status"), dao.QueryOption{
+		Page:     int(page),
+		PageSize: int(size),
+	})
+	if err != nil {
+		log.Errorf("get webhook deliveries: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  deliveries,
+		"total": total,
+	}))
+}
+
+type RedeliverReq struct {
+	DeliveryID string `json:"delivery_id" binding:"required"`
+}
+
+// RedeliverWebhookHandler queues a delivery again, typically a dead letter once the endpoint is fixed.
+func RedeliverWebhookHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	var params RedeliverReq
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrInvalidParams))
+		return
+	}
+
+	delivery, err := dao.GetWebhookDeliveryById(c.Request.Context(), params.DeliveryID)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(errors.ErrNotFound))
+		return
+	}
+
+	if _, err = getUserWebhook(c.Request.Context(), username, delivery.WebhookID); err != nil {
+		c.JSON(http.StatusOK, respError(err))
+		return
+	}
+
+	delivery.Status = model.DeliveryStatusPending
+	delivery.Attempts = 0
+	delivery.Error = ""
+	delivery.NextAttemptAt = time.Now()
+
+	if err = dao.UpdateWebhookDelivery(c.Request.Context(), delivery); err != nil {
+		log.Errorf("update webhook delivery: %v", err)
+		c.JSON(http.StatusOK, respErrorWrapMessage(errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	GlobalServer.webhooks.notify()
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"github.com/gnasnik/titan-workerd-api/config"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestDispatcher(maxAttempts int64, allowPrivate bool) *webhookDispatcher {
+	return newWebhookDispatcher(config.WebhookConfig{
+		MaxAttempts:          maxAttempts,
+		Backoff:              time.Second,
+		Timeout:              time.Second,
+		AllowPrivateNetworks: allowPrivate,
+	})
+}
+
+func TestWebhookAttemptSignsPayload(t *testing.T) {
+	const secret = "s3cret"
+
+	var gotSignature, gotEvent, gotDelivery string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotSignature = r.Header.Get(WebhookHeaderSignature)
+		gotEvent = r.Header.Get(WebhookHeaderEvent)
+		gotDelivery = r.Header.Get(WebhookHeaderDelivery)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	wd := newTestDispatcher(3, true)
+	webhook := &model.Webhook{Url: srv.URL, Secret: secret}
+	delivery := &model.WebhookDelivery{
+		DeliveryID: "d1",
+		Event:      model.EventProjectDeployed,
+		Payload:    `{"id":"d1"}`,
+		Status:     model.DeliveryStatusPending,
+		Attempts:   1,
+	}
+
+	wd.attempt(context.Background(), webhook, delivery)
+
+	if delivery.Status != model.DeliveryStatusDelivered {
+		t.Fatalf("status = %s, want %s (error %q)", delivery.Status, model.DeliveryStatusDelivered, delivery.Error)
+	}
+	if delivery.StatusCode != http.StatusNoContent {
+		t.Errorf("status code = %d, want %d", delivery.StatusCode, http.StatusNoContent)
+	}
+	if string(gotBody) != delivery.Payload {
+		t.Errorf("body = %s, want %s", gotBody, delivery.Payload)
+	}
+	if want := signWebhookPayload(secret, gotBody); gotSignature != want {
+		t.Errorf("signature = %s, want %s", gotSignature, want)
+	}
+	if gotSignature == signWebhookPayload("other", gotBody) {
+		t.Errorf("signature does not depend on the secret")
+	}
+	if gotEvent != delivery.Event || gotDelivery != delivery.DeliveryID {
+		t.Errorf("headers = %s %s, want %s %s", gotEvent, gotDelivery, delivery.Event, delivery.DeliveryID)
+	}
+}
+
+func TestWebhookAttemptRetriesThenDeadLetters(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	wd := newTestDispatcher(3, true)
+	webhook := &model.Webhook{Url: srv.URL, Secret: "s3cret"}
+	delivery := &model.WebhookDelivery{DeliveryID: "d1", Payload: `{}`, Status: model.DeliveryStatusPending}
+
+	for attempt := int64(1); attempt < wd.maxAttempts; attempt++ {
+		delivery.Attempts = attempt
+		before := time.Now()
+		wd.attempt(context.Background(), webhook, delivery)
+
+		if delivery.Status != model.DeliveryStatusPending {
+			t.Fatalf("attempt %d: status = %s, want %s", attempt, delivery.Status, model.DeliveryStatusPending)
+		}
+		if delivery.StatusCode != http.StatusInternalServerError || delivery.Error == "" {
+			t.Fatalf("attempt %d: status code %d error %q", attempt, delivery.StatusCode, delivery.Error)
+		}
+		if delay := delivery.NextAttemptAt.Sub(before); delay < wd.backoffDelay(attempt) {
+			t.Errorf("attempt %d: next attempt in %s, want at least %s", attempt, delay, wd.backoffDelay(attempt))
+		}
+	}
+
+	delivery.Attempts = wd.maxAttempts
+	wd.attempt(context.Background(), webhook, delivery)
+
+	if delivery.Status != model.DeliveryStatusDead {
+		t.Fatalf("status = %s, want %s", delivery.Status, model.DeliveryStatusDead)
+	}
+	if calls != int(wd.maxAttempts) {
+		t.Errorf("calls = %d, want %d", calls, wd.maxAttempts)
+	}
+}
+
+func TestWebhookBackoffDelay(t *testing.T) {
+	wd := newTestDispatcher(3, true)
+
+	tests := []struct {
+		attempts int64
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{10, 512 * time.Second},
+		{1000, maxWebhookBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := wd.backoffDelay(tt.attempts); got != tt.want {
+			t.Errorf("backoffDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	wd := newTestDispatcher(1, false)
+	delivery := &model.WebhookDelivery{DeliveryID: "d1", Payload: `{}`, Attempts: 1}
+
+	wd.attempt(context.Background(), &model.Webhook{Url: srv.URL}, delivery)
+
+	if delivery.Status != model.DeliveryStatusDead || delivery.StatusCode != 0 {
+		t.Fatalf("status = %s code %d, want %s without response", delivery.Status, delivery.StatusCode, model.DeliveryStatusDead)
+	}
+
+	if err := wd.checkWebhookURL(context.Background(), srv.URL); err == nil {
+		t.Errorf("checkWebhookURL(%s) accepted a loopback address", srv.URL)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":     true,
+		"127.0.0.1":   false,
+		"10.1.2.3":    false,
+		"192.168.1.1": false,
+		"169.254.1.1": false,
+		"100.64.0.1":  false,
+		"0.0.0.0":     false,
+		"::1":         false,
+		"fe80::1":     false,
+	}
+
+	for addr, want := range tests {
+		if got := isPublicIP(net.ParseIP(addr)); got != want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 var Cfg Config
 
 type Config struct {
@@ -10,10 +12,189 @@ type Config struct {
 	EtcdAddresses []string
 	EtcdUser      string
 	EtcdPassword  string
+	// Discovery of the schedulers: "etcd" by default, "static" for Schedulers or "file" for SchedulerFile.
+	Discovery     string
+	Schedulers    []SchedulerConfig
+	SchedulerTLS  SchedulerTLSConfig
+	SchedulerRPC  SchedulerRPCConfig
+	SchedulerFile SchedulerFileConfig
 	IpDataCloud   IpDataCloudConfig
+	Reconcile     ReconcileConfig
+	Autoscale     AutoscaleConfig
+	HealthCheck   HealthCheckConfig
+	Rollout       RolloutConfig
+	Webhook       WebhookConfig
+	Stream        StreamConfig
+	Logs          LogsConfig
+	Scheduler     SchedulerHealthConfig
+	Selector      SelectorConfig
+	Capacity      CapacityConfig
+	NodeIndex     NodeIndexConfig
+	Migration     MigrationConfig
+}
+
+type SchedulerConfig struct {
+	URL         string
+	AccessToken string
+	AreaID      string
+}
+
+type SchedulerTLSConfig struct {
+	// CAFile is a PEM bundle of the CAs trusted for the scheduler certificates, the system pool is used when empty.
+	CAFile string
+	// CertFile and KeyFile are the client certificate presented to the schedulers.
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+	// InsecureAreas are the areas whose schedulers may be reached over plain http.
+	InsecureAreas []string
+	Overrides     []SchedulerTLSOverride
+}
+
+// SchedulerTLSOverride replaces the tls settings for the scheduler with the URL, or for the schedulers of the area,
+// the fields left empty keep the defaults.
+type SchedulerTLSOverride struct {
+	URL                string
+	AreaID             string
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+type SchedulerRPCConfig struct {
+	// Timeout of a scheduler call, of every attempt for the retried reads.
+	Timeout time.Duration
+	// Timeouts overrides the timeout by method name, such as DeployProject.
+	Timeouts map[string]time.Duration
+	// MaxAttempts of the idempotent reads, 1 disables the retries.
+	MaxAttempts int
+	// Backoff before the first retry of a read, it doubles on every retry and is spread by a random jitter.
+	Backoff time.Duration
+	// MaxBackoff caps the doubled backoff, 5s when zero.
+	MaxBackoff time.Duration
+	// HedgeDelay after which a read still waiting for its answer is sent again, reads are not hedged when it is zero.
+	HedgeDelay time.Duration
+}
+
+type SchedulerFileConfig struct {
+	// Path of a toml, json or yaml file with a Schedulers list.
+	Path string
+	// Interval between two checks of the file for changes.
+	Interval time.Duration
 }
 
 type IpDataCloudConfig struct {
 	Url string
 	Key string
 }
+
+type ReconcileConfig struct {
+	// Interval between two reconcile runs, the reconciler is disabled when it is zero.
+	Interval time.Duration
+	// Policy is either "report" or "heal".
+	Policy string
+}
+
+type AutoscaleConfig struct {
+	// Interval between two evaluations of the autoscaling policies, the autoscaler is disabled when it is zero.
+	Interval time.Duration
+	// MetricsURL is queried with the project_id for the metrics of a project, scale rules are ignored when it is empty.
+	MetricsURL string
+}
+
+type HealthCheckConfig struct {
+	// Interval between two scans for due health checks, health checks are disabled when it is zero.
+	Interval time.Duration
+	// Retention is how long the health history is kept.
+	Retention time.Duration
+}
+
+type RolloutConfig struct {
+	// Interval between two scans for rollouts due to advance, rollouts do not progress when it is zero.
+	Interval time.Duration
+}
+
+type WebhookConfig struct {
+	// Interval between two scans for due deliveries.
+	Interval time.Duration
+	// MaxAttempts before a delivery is given up and kept as a dead letter.
+	MaxAttempts int64
+	// Backoff is the delay before the first retry, it doubles on every attempt.
+	Backoff time.Duration
+	Timeout time.Duration
+	// AllowPrivateNetworks lets the webhooks target loopback, private and link-local addresses, for local testing.
+	AllowPrivateNetworks bool
+}
+
+type StreamConfig struct {
+	// PollInterval between two polls of the state of the projects watched by stream subscribers.
+	PollInterval time.Duration
+}
+
+type LogsConfig struct {
+	// Source of the project logs: "node" queries the nodes running the replicas, "fake" generates entries.
+	Source string
+	// NodePort and NodePath locate the log endpoint of the nodes.
+	NodePort int64
+	NodePath string
+	// TailInterval between two polls of the log source when tailing.
+	TailInterval time.Duration
+}
+
+type SchedulerHealthConfig struct {
+	// Interval between two probes of every scheduler, 15s when zero.
+	Interval time.Duration
+	// Timeout of a probe.
+	Timeout time.Duration
+	// FailureThreshold is the number of consecutive failures opening the circuit breaker of a scheduler.
+	FailureThreshold int
+	// Cooldown is how long a scheduler stays out of the selection before a success can bring it back.
+	Cooldown time.Duration
+}
+
+type SelectorConfig struct {
+	// Chain is the default scheduler selector chain, selectors are tried in order: "nearest", "scored", "prefix",
+	// "least-loaded", "random", "pin" for the requested area or "pin:<area id>".
+	Chain []string
+	// Whitelist restricts the random selector to these areas when any of them is available.
+	Whitelist []string
+	Weights   []SelectorWeight
+	// Users override the chain for some users.
+	Users []SelectorUser
+}
+
+type SelectorWeight struct {
+	AreaID string
+	// Weight of the area for the random selector, areas without a weight count as 1.
+	Weight int
+}
+
+type SelectorUser struct {
+	Username string
+	Chain    []string
+}
+
+type CapacityConfig struct {
+	// Interval between two refreshes of the capacity of the schedulers, capacity is only fetched on demand and
+	// cached for a minute when it is zero.
+	Interval time.Duration
+	// Weights of the distance, available nodes and deploy failure rate in the score of the scored selector.
+	DistanceWeight float64
+	CapacityWeight float64
+	FailureWeight  float64
+}
+
+type NodeIndexConfig struct {
+	// Interval between two rebuilds of the node to scheduler index, it is still rebuilt when the schedulers change.
+	Interval time.Duration
+}
+
+type MigrationConfig struct {
+	// Interval between two advances of the running migrations, migrations do not progress when it is zero.
+	Interval time.Duration
+	// HealthTimeout is how long a migrated project has to become healthy in the target area before it is rolled back.
+	HealthTimeout time.Duration
+}
@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"context"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"time"
+)
+
+func UpsertAutoscalePolicy(ctx context.Context, policy *model.AutoscalePolicy) error {
+	_, err := DB.NamedExecContext(ctx, `
+		INSERT INTO autoscale_policy (project_id, min_replicas, max_replicas, cooldown, schedules, rules, enabled, last_scaled_at, created_at, updated_at)
+			VALUES (:project_id, :min_replicas, :max_replicas, :cooldown, :schedules, :rules, :enabled, now(), now(), now())
+			ON DUPLICATE KEY UPDATE min_replicas = VALUES(min_replicas), max_replicas = VALUES(max_replicas), cooldown = VALUES(cooldown),
+			schedules = VALUES(schedules), rules = VALUES(rules), enabled = VALUES(enabled), updated_at = now();`,
+		policy)
+	return err
+}
+
+func GetAutoscalePolicy(ctx context.Context, projectId string) (*model.AutoscalePolicy, error) {
+	var out model.AutoscalePolicy
+	if err := DB.GetContext(ctx, &out, `SELECT * FROM autoscale_policy WHERE project_id = ?`, projectId); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func GetEnabledAutoscalePolicies(ctx context.Context) ([]*model.AutoscalePolicy, error) {
+	var out []*model.AutoscalePolicy
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM autoscale_policy WHERE enabled = 1 order by id`)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func UpdateAutoscaleLastScaledAt(ctx context.Context, projectId string, scaledAt time.Time) error {
+	_, err := DB.ExecContext(ctx, `UPDATE autoscale_policy SET last_scaled_at = ? WHERE project_id = ?`, scaledAt, projectId)
+	return err
+}
+
+func DeleteAutoscalePolicy(ctx context.Context, projectId string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM autoscale_policy WHERE project_id = ?`, projectId)
+	return err
+}
+
+func AddAutoscaleEvent(ctx context.Context, event *model.AutoscaleEvent) error {
+	_, err := DB.NamedExecContext(ctx, `
+		INSERT INTO autoscale_event (project_id, from_replicas, to_replicas, reason, status, error, created_at)
+			VALUES (:project_id, :from_replicas, :to_replicas, :reason, :status, :error, now());`,
+		event)
+	return err
+}
+
+func GetAutoscaleEvents(ctx context.Context, projectId string, option QueryOption) (int64, []*model.AutoscaleEvent, error) {
+	var total int64
+	var out []*model.AutoscaleEvent
+
+	limit := option.PageSize
+	offset := option.Page
+	if option.PageSize <= 0 {
+		limit = 50
+	}
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	err := DB.GetContext(ctx, &total, `SELECT count(*) FROM autoscale_event WHERE project_id = ?`, projectId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = DB.SelectContext(ctx, &out, `SELECT * FROM autoscale_event WHERE project_id = ? order by id DESC LIMIT ? OFFSET ?`, projectId, limit, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return total, out, nil
+}
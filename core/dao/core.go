@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/gnasnik/titan-workerd-api/config"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
 	_ "github.com/go-sql-driver/mysql"
 	logging "github.com/ipfs/go-log"
 	"github.com/jmoiron/sqlx"
@@ -67,4 +68,7 @@ type QueryOption struct {
 	StartTime  string `json:"start_time"`
 	EndTime    string `json:"end_time" `
 	UserID     string `json:"user_id"`
+	OrgID      string `json:"org_id"`
+
+	Labels []*model.LabelRequirement `json:"labels"`
 }
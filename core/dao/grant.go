@@ -0,0 +1,52 @@
+package dao
+
+import (
+	"context"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+)
+
+func UpsertProjectGrant(ctx context.Context, grant *model.ProjectGrant) error {
+	_, err := DB.NamedExecContext(ctx, `
+		INSERT INTO project_grant (project_id, user_id, role, granted_by, created_at, updated_at)
+			VALUES (:project_id, :user_id, :role, :granted_by, now(), now())
+			ON DUPLICATE KEY UPDATE role = VALUES(role), granted_by = VALUES(granted_by), updated_at = now();`,
+		grant)
+	return err
+}
+
+func GetProjectGrant(ctx context.Context, projectId, userId string) (*model.ProjectGrant, error) {
+	var out model.ProjectGrant
+	if err := DB.GetContext(ctx, &out, `SELECT * FROM project_grant WHERE project_id = ? AND user_id = ?`, projectId, userId); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func GetProjectGrants(ctx context.Context, projectId string) ([]*model.ProjectGrant, error) {
+	var out []*model.ProjectGrant
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM project_grant WHERE project_id = ? order by id`, projectId)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetGrantedProjectIds returns the projects shared with the user.
+func GetGrantedProjectIds(ctx context.Context, userId string) ([]string, error) {
+	var out []string
+	err := DB.SelectContext(ctx, &out, `SELECT project_id FROM project_grant WHERE user_id = ?`, userId)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func DeleteProjectGrant(ctx context.Context, projectId, userId string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM project_grant WHERE project_id = ? AND user_id = ?`, projectId, userId)
+	return err
+}
+
+func DeleteProjectGrants(ctx context.Context, projectId string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM project_grant WHERE project_id = ?`, projectId)
+	return err
+}
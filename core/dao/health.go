@@ -0,0 +1,94 @@
+package dao
+
+import (
+	"context"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"time"
+)
+
+func UpsertProjectHealthCheck(ctx context.Context, check *model.ProjectHealthCheck) error {
+	_, err := DB.NamedExecContext(ctx, `
+		INSERT INTO project_health_check (project_id, mode, path, port, expected_status, check_interval, timeout, failure_threshold, remediate, enabled, consecutive_failures, last_checked_at, created_at, updated_at)
+			VALUES (:project_id, :mode, :path, :port, :expected_status, :check_interval, :timeout, :failure_threshold, :remediate, :enabled, 0, now(), now(), now())
+			ON DUPLICATE KEY UPDATE mode = VALUES(mode), path = VALUES(path), port = VALUES(port), expected_status = VALUES(expected_status),
+			check_interval = VALUES(check_interval), timeout = VALUES(timeout), failure_threshold = VALUES(failure_threshold), remediate = VALUES(remediate),
+			enabled = VALUES(enabled), consecutive_failures = 0, updated_at = now();`,
+		check)
+	return err
+}
+
+func GetProjectHealthCheck(ctx context.Context, projectId string) (*model.ProjectHealthCheck, error) {
+	var out model.ProjectHealthCheck
+	if err := DB.GetContext(ctx, &out, `SELECT * FROM project_health_check WHERE project_id = ?`, projectId); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDueProjectHealthChecks returns the enabled health checks whose interval elapsed since their last probe.
+func GetDueProjectHealthChecks(ctx context.Context, now time.Time) ([]*model.ProjectHealthCheck, error) {
+	var out []*model.ProjectHealthCheck
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM project_health_check WHERE enabled = 1 AND DATE_ADD(last_checked_at, INTERVAL check_interval SECOND) <= ? order by id`, now)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func UpdateProjectHealthCheckResult(ctx context.Context, projectId string, failures int64, checkedAt time.Time) error {
+	_, err := DB.ExecContext(ctx, `UPDATE project_health_check SET consecutive_failures = ?, last_checked_at = ? WHERE project_id = ?`, failures, checkedAt, projectId)
+	return err
+}
+
+func DeleteProjectHealthCheck(ctx context.Context, projectId string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM project_health_check WHERE project_id = ?`, projectId)
+	return err
+}
+
+func AddProjectHealthRecords(ctx context.Context, records []*model.ProjectHealthRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	_, err := DB.NamedExecContext(ctx, `
+		INSERT INTO project_health_record (project_id, target, node_id, healthy, status_code, latency, error, redeployed, created_at)
+			VALUES (:project_id, :target, :node_id, :healthy, :status_code, :latency, :error, :redeployed, now());`,
+		records)
+	return err
+}
+
+func GetProjectHealthRecords(ctx context.Context, projectId string, option QueryOption) (int64, []*model.ProjectHealthRecord, error) {
+	var total int64
+	var out []*model.ProjectHealthRecord
+
+	limit := option.PageSize
+	offset := option.Page
+	if option.PageSize <= 0 {
+		limit = 50
+	}
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	err := DB.GetContext(ctx, &total, `SELECT count(*) FROM project_health_record WHERE project_id = ?`, projectId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = DB.SelectContext(ctx, &out, `SELECT * FROM project_health_record WHERE project_id = ? order by id DESC LIMIT ? OFFSET ?`, projectId, limit, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return total, out, nil
+}
+
+func DeleteProjectHealthRecords(ctx context.Context, projectId string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM project_health_record WHERE project_id = ?`, projectId)
+	return err
+}
+
+func DeleteProjectHealthRecordsBefore(ctx context.Context, before time.Time) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM project_health_record WHERE created_at < ?`, before)
+	return err
+}
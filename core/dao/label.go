@@ -0,0 +1,115 @@
+package dao
+
+import (
+	"context"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"github.com/jmoiron/sqlx"
+	"strings"
+)
+
+func SetProjectLabels(ctx context.Context, projectId string, labels map[string]string) error {
+	tx, err := DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM project_label WHERE project_id = ?`, projectId)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range labels {
+		_, err = tx.ExecContext(ctx, `INSERT INTO project_label (project_id, label_key, label_value, created_at) VALUES (?, ?, ?, now())`,
+			projectId, key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func UpsertProjectLabel(ctx context.Context, projectId, key, value string) error {
+	_, err := DB.ExecContext(ctx, `INSERT INTO project_label (project_id, label_key, label_value, created_at) VALUES (?, ?, ?, now())
+		ON DUPLICATE KEY UPDATE label_value = VALUES(label_value)`, projectId, key, value)
+	return err
+}
+
+func DeleteProjectLabel(ctx context.Context, projectId, key string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM project_label WHERE project_id = ? AND label_key = ?`, projectId, key)
+	return err
+}
+
+func DeleteProjectLabels(ctx context.Context, projectId string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM project_label WHERE project_id = ?`, projectId)
+	return err
+}
+
+// GetProjectLabels returns the labels of the given projects keyed by project id.
+func GetProjectLabels(ctx context.Context, projectIds []string) (map[string]map[string]string, error) {
+	out := make(map[string]map[string]string)
+	if len(projectIds) == 0 {
+		return out, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT * FROM project_label WHERE project_id IN (?)`, projectIds)
+	if err != nil {
+		return nil, err
+	}
+
+	var labels []*model.ProjectLabel
+	if err = DB.SelectContext(ctx, &labels, DB.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	for _, label := range labels {
+		if _, ok := out[label.ProjectID]; !ok {
+			out[label.ProjectID] = make(map[string]string)
+		}
+		out[label.ProjectID][label.LabelKey] = label.LabelValue
+	}
+
+	return out, nil
+}
+
+// labelSelectorCondition turns the selector into a condition on project.project_id.
+func labelSelectorCondition(selector []*model.LabelRequirement) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	for _, req := range selector {
+		switch req.Operator {
+		case model.LabelOperatorEquals:
+			conditions = append(conditions, `project_id IN (SELECT project_id FROM project_label WHERE label_key = ? AND label_value = ?)`)
+			args = append(args, req.Key, req.Value)
+		case model.LabelOperatorNotEquals:
+			conditions = append(conditions, `project_id NOT IN (SELECT project_id FROM project_label WHERE label_key = ? AND label_value = ?)`)
+			args = append(args, req.Key, req.Value)
+		case model.LabelOperatorExists:
+			conditions = append(conditions, `project_id IN (SELECT project_id FROM project_label WHERE label_key = ?)`)
+			args = append(args, req.Key)
+		}
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// GetProjectsBySelector returns the projects of the workspace of the option matching its labels.
+func GetProjectsBySelector(ctx context.Context, option QueryOption) ([]*model.Project, error) {
+	where, args := workspaceCondition(option)
+
+	if condition, conditionArgs := labelSelectorCondition(option.Labels); condition != "" {
+		where += ` AND ` + condition
+		args = append(args, conditionArgs...)
+	}
+
+	var out []*model.Project
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM project WHERE `+where+` order by created_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,134 @@
+package dao
+
+import (
+	"context"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+)
+
+func AddMigrationJob(ctx context.Context, job *model.MigrationJob, tasks []*model.MigrationTask) error {
+	tx, err := DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.NamedExecContext(ctx, `
+		INSERT INTO migration_job (job_id, project_id, source_area_id, target_area_id, status, message, created_by, created_at, updated_at)
+			VALUES (:job_id, :project_id, :source_area_id, :target_area_id, :status, :message, :created_by, now(), now());`,
+		job)
+	if err != nil {
+		return err
+	}
+
+	if len(tasks) > 0 {
+		_, err = tx.NamedExecContext(ctx, `
+			INSERT INTO migration_task (job_id, project_id, status, replicas, message, deployed_at, created_at, updated_at)
+				VALUES (:job_id, :project_id, :status, :replicas, :message, now(), now(), now());`,
+			tasks)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func UpdateMigrationJob(ctx context.Context, job *model.MigrationJob) error {
+	_, err := DB.NamedExecContext(ctx, `
+		UPDATE migration_job SET status = :status, message = :message, updated_at = now() WHERE job_id = :job_id`,
+		job)
+	return err
+}
+
+func GetMigrationJobById(ctx context.Context, jobId string) (*model.MigrationJob, error) {
+	var out model.MigrationJob
+	if err := DB.GetContext(ctx, &out, `SELECT * FROM migration_job WHERE job_id = ?`, jobId); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func GetMigrationJobs(ctx context.Context, option QueryOption) (int64, []*model.MigrationJob, error) {
+	limit := option.PageSize
+	offset := option.Page
+	if option.PageSize <= 0 {
+		limit = 50
+	}
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	var total int64
+	if err := DB.GetContext(ctx, &total, `SELECT count(*) FROM migration_job`); err != nil {
+		return 0, nil, err
+	}
+
+	var out []*model.MigrationJob
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM migration_job order by id DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return total, out, nil
+}
+
+func GetMigrationJobsByStatus(ctx context.Context, status string) ([]*model.MigrationJob, error) {
+	var out []*model.MigrationJob
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM migration_job WHERE status = ? order by id`, status)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetActiveMigrationTask returns the task of a running job migrating the project.
+func GetActiveMigrationTask(ctx context.Context, projectId string) (*model.MigrationTask, error) {
+	var out model.MigrationTask
+	err := DB.GetContext(ctx, &out, `
+		SELECT t.* FROM migration_task t JOIN migration_job j ON t.job_id = j.job_id
+			WHERE t.project_id = ? AND t.status IN (?, ?) AND j.status = ? LIMIT 1`,
+		projectId, model.MigrationTaskPending, model.MigrationTaskDeployed, model.MigrationStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func GetMigrationTasks(ctx context.Context, jobId string) ([]*model.MigrationTask, error) {
+	var out []*model.MigrationTask
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM migration_task WHERE job_id = ? order by id`, jobId)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func UpdateMigrationTask(ctx context.Context, task *model.MigrationTask) error {
+	_, err := DB.NamedExecContext(ctx, `
+		UPDATE migration_task SET status = :status, replicas = :replicas, message = :message, deployed_at = :deployed_at, updated_at = now()
+			WHERE job_id = :job_id AND project_id = :project_id`,
+		task)
+	return err
+}
+
+// ResetFailedMigrationTasks puts the failed tasks of the job back to pending.
+func ResetFailedMigrationTasks(ctx context.Context, jobId string) error {
+	_, err := DB.ExecContext(ctx, `UPDATE migration_task SET status = ?, message = '', updated_at = now() WHERE job_id = ? AND status = ?`,
+		model.MigrationTaskPending, jobId, model.MigrationTaskFailed)
+	return err
+}
+
+// GetProjectIdsInArea returns the projects placed in the area, including the projects created before placements
+// were recorded. The placements of canary projects, which have no project row, are left out.
+func GetProjectIdsInArea(ctx context.Context, areaId string) ([]string, error) {
+	var out []string
+	err := DB.SelectContext(ctx, &out, `
+		SELECT project_id FROM project_placement WHERE area_id = ? AND project_id IN (SELECT project_id FROM project)
+		UNION
+		SELECT project_id FROM project WHERE FIND_IN_SET(?, area_id) AND project_id NOT IN (SELECT project_id FROM project_placement)`,
+		areaId, areaId)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
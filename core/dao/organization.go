@@ -0,0 +1,90 @@
+package dao
+
+import (
+	"context"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+)
+
+func CreateOrganization(ctx context.Context, org *model.Organization, owner *model.OrganizationMember) error {
+	tx, err := DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.NamedExecContext(ctx, `
+		INSERT INTO organization (org_id, name, created_by, max_projects, max_replicas, created_at, updated_at)
+			VALUES (:org_id, :name, :created_by, :max_projects, :max_replicas, now(), now());`, org)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NamedExecContext(ctx, `
+		INSERT INTO organization_member (org_id, user_id, role, created_at, updated_at)
+			VALUES (:org_id, :user_id, :role, now(), now());`, owner)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func GetOrganizationById(ctx context.Context, orgId string) (*model.Organization, error) {
+	var out model.Organization
+	if err := DB.GetContext(ctx, &out, `SELECT * FROM organization WHERE org_id = ?`, orgId); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func GetOrganizationsByUserId(ctx context.Context, userId string) ([]*model.Organization, error) {
+	var out []*model.Organization
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM organization WHERE org_id IN (SELECT org_id FROM organization_member WHERE user_id = ?) order by id`, userId)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func UpdateOrganizationQuota(ctx context.Context, orgId string, maxProjects, maxReplicas int64) error {
+	_, err := DB.ExecContext(ctx, `UPDATE organization set max_projects = ?, max_replicas = ?, updated_at = now() WHERE org_id = ?`, maxProjects, maxReplicas, orgId)
+	return err
+}
+
+func UpsertOrganizationMember(ctx context.Context, member *model.OrganizationMember) error {
+	_, err := DB.NamedExecContext(ctx, `
+		INSERT INTO organization_member (org_id, user_id, role, created_at, updated_at)
+			VALUES (:org_id, :user_id, :role, now(), now())
+			ON DUPLICATE KEY UPDATE role = VALUES(role), updated_at = now();`, member)
+	return err
+}
+
+func GetOrganizationMember(ctx context.Context, orgId, userId string) (*model.OrganizationMember, error) {
+	var out model.OrganizationMember
+	if err := DB.GetContext(ctx, &out, `SELECT * FROM organization_member WHERE org_id = ? AND user_id = ?`, orgId, userId); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func GetOrganizationMembers(ctx context.Context, orgId string) ([]*model.OrganizationMember, error) {
+	var out []*model.OrganizationMember
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM organization_member WHERE org_id = ? order by id`, orgId)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func DeleteOrganizationMember(ctx context.Context, orgId, userId string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM organization_member WHERE org_id = ? AND user_id = ?`, orgId, userId)
+	return err
+}
+
+func GetOrganizationUsage(ctx context.Context, orgId string) (*model.OrgUsage, error) {
+	var out model.OrgUsage
+	if err := DB.GetContext(ctx, &out, `SELECT count(*) AS projects, COALESCE(sum(replicas), 0) AS replicas FROM project WHERE org_id = ?`, orgId); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,59 @@
+package dao
+
+import (
+	"context"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+)
+
+func UpsertProjectPlacement(ctx context.Context, placement *model.ProjectPlacement) error {
+	_, err := DB.NamedExecContext(ctx, `
+		INSERT INTO project_placement (project_id, area_id, replicas, created_at, updated_at)
+			VALUES (:project_id, :area_id, :replicas, now(), now())
+			ON DUPLICATE KEY UPDATE replicas = VALUES(replicas), updated_at = now();`,
+		placement)
+	return err
+}
+
+func GetProjectPlacements(ctx context.Context, projectId string) ([]*model.ProjectPlacement, error) {
+	var out []*model.ProjectPlacement
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM project_placement WHERE project_id = ? order by id`, projectId)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func UpdateProjectPlacementReplicas(ctx context.Context, projectId, areaId string, replicas int64) error {
+	_, err := DB.ExecContext(ctx, `UPDATE project_placement set replicas = ?, updated_at = now() WHERE project_id = ? AND area_id = ?`, replicas, projectId, areaId)
+	return err
+}
+
+func DeleteProjectPlacement(ctx context.Context, projectId, areaId string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM project_placement WHERE project_id = ? AND area_id = ?`, projectId, areaId)
+	return err
+}
+
+func DeleteProjectPlacements(ctx context.Context, projectId string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM project_placement WHERE project_id = ?`, projectId)
+	return err
+}
+
+// CountProjectsByArea returns the number of projects placed in each area.
+func CountProjectsByArea(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		AreaID string `db:"area_id"`
+		Count  int64  `db:"count"`
+	}
+
+	err := DB.SelectContext(ctx, &rows, `SELECT area_id, COUNT(DISTINCT project_id) AS count FROM project_placement GROUP BY area_id`)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]int64)
+	for _, row := range rows {
+		out[row.AreaID] = row.Count
+	}
+
+	return out, nil
+}
@@ -4,18 +4,20 @@ import (
 	"context"
 	"fmt"
 	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"time"
 )
 
 func AddProject(ctx context.Context, project *model.Project) error {
 	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(`
-		INSERT INTO project ( user_id, project_id, name, area_id, region, bundle_url, status, replicas, cpu_cores, memory, expiration, version, created_at, updated_at)
-			VALUES (:user_id, :project_id, :name, :area_id, :region, :bundle_url, :status, :replicas, :cpu_cores, :memory, :expiration, :version, now(), now());`,
+		INSERT INTO project ( user_id, project_id, name, area_id, region, bundle_url, status, replicas, cpu_cores, memory, expiration, node_ids, version, description, org_id, created_at, updated_at)
+			VALUES (:user_id, :project_id, :name, :area_id, :region, :bundle_url, :status, :replicas, :cpu_cores, :memory, :expiration, :node_ids, :version, :description, :org_id, now(), now());`,
 	), project)
 	return err
 }
 
 func UpdateProject(ctx context.Context, project *model.Project) error {
-	_, err := DB.ExecContext(ctx, `UPDATE project set name = ?, bundle_url = ?, replicas = ? WHERE project_id = ?`, project.Name, project.BundleUrl, project.Replicas, project.ProjectID)
+	_, err := DB.ExecContext(ctx, `UPDATE project set name = ?, bundle_url = ?, replicas = ?, description = ? WHERE project_id = ?`,
+		project.Name, project.BundleUrl, project.Replicas, project.Description, project.ProjectID)
 	return err
 }
 
@@ -45,15 +47,91 @@ func GetProjectByUserId(ctx context.Context, option QueryOption) (int64, []*mode
 		offset = limit * (option.Page - 1)
 	}
 
-	err := DB.GetContext(ctx, &total, `SELECT count(*) FROM project`)
+	where, args := workspaceCondition(option)
+
+	if condition, conditionArgs := labelSelectorCondition(option.Labels); condition != "" {
+		where += ` AND ` + condition
+		args = append(args, conditionArgs...)
+	}
+
+	err := DB.GetContext(ctx, &total, `SELECT count(*) FROM project WHERE `+where, args...)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	err = DB.SelectContext(ctx, &out, `SELECT * FROM project where user_id = ? order by created_at DESC LIMIT ? OFFSET ?`, option.UserID, limit, offset)
+	err = DB.SelectContext(ctx, &out, `SELECT * FROM project WHERE `+where+` order by created_at DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
 	if err != nil {
 		return 0, nil, err
 	}
 
 	return total, out, err
 }
+
+// workspaceCondition matches the projects of the workspace of the option: the projects of the organization, or in the
+// personal workspace the projects of the user along with the projects shared with it.
+func workspaceCondition(option QueryOption) (string, []interface{}) {
+	if option.OrgID != "" {
+		return `org_id = ?`, []interface{}{option.OrgID}
+	}
+
+	return `org_id = '' AND (user_id = ? OR project_id IN (SELECT project_id FROM project_grant WHERE user_id = ?))`,
+		[]interface{}{option.UserID, option.UserID}
+}
+
+// GetWorkspaceProjects returns every project of the workspace of the option.
+func GetWorkspaceProjects(ctx context.Context, option QueryOption) ([]*model.Project, error) {
+	where, args := workspaceCondition(option)
+
+	var out []*model.Project
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM project WHERE `+where+` order by id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func GetAllProjects(ctx context.Context, limit, offset int) ([]*model.Project, error) {
+	var out []*model.Project
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM project order by id LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetWorkspaceProjectsByName returns the projects of the workspace of the option with the given name.
+func GetWorkspaceProjectsByName(ctx context.Context, option QueryOption, name string) ([]*model.Project, error) {
+	where, args := workspaceCondition(option)
+
+	var out []*model.Project
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM project WHERE `+where+` AND name = ?`, append(args, name)...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func UpdateProjectAreaId(ctx context.Context, projectId, areaId string, replicas int64) error {
+	_, err := DB.ExecContext(ctx, `UPDATE project set area_id = ?, replicas = ?, updated_at = now() WHERE project_id = ?`, areaId, replicas, projectId)
+	return err
+}
+
+func UpdateProjectExpiration(ctx context.Context, projectId string, expiration time.Time) error {
+	_, err := DB.ExecContext(ctx, `UPDATE project set expiration = ?, updated_at = now() WHERE project_id = ?`, expiration, projectId)
+	return err
+}
+
+func UpdateProjectOwner(ctx context.Context, projectId, userId string) error {
+	_, err := DB.ExecContext(ctx, `UPDATE project set user_id = ?, updated_at = now() WHERE project_id = ?`, userId, projectId)
+	return err
+}
+
+// GetProjectsExpiredBetween returns the projects whose expiration falls in [from, to).
+func GetProjectsExpiredBetween(ctx context.Context, from, to time.Time) ([]*model.Project, error) {
+	var out []*model.Project
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM project WHERE expiration >= ? AND expiration < ? order by id`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
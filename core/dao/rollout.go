@@ -0,0 +1,61 @@
+package dao
+
+import (
+	"context"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"time"
+)
+
+func AddProjectRollout(ctx context.Context, rollout *model.ProjectRollout) error {
+	_, err := DB.NamedExecContext(ctx, `
+		INSERT INTO project_rollout (rollout_id, project_id, strategy, status, bundle_url, previous_bundle_url, steps, step, step_wait, target_project_id, message, created_by, next_step_at, created_at, updated_at)
+			VALUES (:rollout_id, :project_id, :strategy, :status, :bundle_url, :previous_bundle_url, :steps, :step, :step_wait, :target_project_id, :message, :created_by, :next_step_at, now(), now());`,
+		rollout)
+	return err
+}
+
+func UpdateProjectRollout(ctx context.Context, rollout *model.ProjectRollout) error {
+	_, err := DB.NamedExecContext(ctx, `
+		UPDATE project_rollout SET status = :status, step = :step, message = :message, next_step_at = :next_step_at, updated_at = now()
+			WHERE rollout_id = :rollout_id`,
+		rollout)
+	return err
+}
+
+func GetProjectRolloutById(ctx context.Context, rolloutId string) (*model.ProjectRollout, error) {
+	var out model.ProjectRollout
+	if err := DB.GetContext(ctx, &out, `SELECT * FROM project_rollout WHERE rollout_id = ?`, rolloutId); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetActiveProjectRollout returns the running or paused rollout of the project.
+func GetActiveProjectRollout(ctx context.Context, projectId string) (*model.ProjectRollout, error) {
+	var out model.ProjectRollout
+	err := DB.GetContext(ctx, &out, `SELECT * FROM project_rollout WHERE project_id = ? AND status IN (?, ?) LIMIT 1`,
+		projectId, model.RolloutStatusRunning, model.RolloutStatusPaused)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func GetProjectRollouts(ctx context.Context, projectId string) ([]*model.ProjectRollout, error) {
+	var out []*model.ProjectRollout
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM project_rollout WHERE project_id = ? order by id DESC`, projectId)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func GetDueProjectRollouts(ctx context.Context, now time.Time) ([]*model.ProjectRollout, error) {
+	var out []*model.ProjectRollout
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM project_rollout WHERE status = ? AND next_step_at <= ? order by id`,
+		model.RolloutStatusRunning, now)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,37 @@
+package dao
+
+import (
+	"context"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+)
+
+func AddProjectTemplate(ctx context.Context, template *model.ProjectTemplate) error {
+	_, err := DB.NamedExecContext(ctx, `
+		INSERT INTO project_template (template_id, user_id, name, description, bundle_url, replicas, cpu_cores, memory, version, published, created_at, updated_at)
+			VALUES (:template_id, :user_id, :name, :description, :bundle_url, :replicas, :cpu_cores, :memory, :version, :published, now(), now());`,
+		template)
+	return err
+}
+
+func GetProjectTemplateById(ctx context.Context, templateId string) (*model.ProjectTemplate, error) {
+	var out model.ProjectTemplate
+	if err := DB.GetContext(ctx, &out, `SELECT * FROM project_template WHERE template_id = ?`, templateId); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetProjectTemplates returns the templates of the user along with every published template.
+func GetProjectTemplates(ctx context.Context, userId string) ([]*model.ProjectTemplate, error) {
+	var out []*model.ProjectTemplate
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM project_template WHERE user_id = ? OR published = 1 order by id desc`, userId)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func DeleteProjectTemplate(ctx context.Context, templateId string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM project_template WHERE template_id = ?`, templateId)
+	return err
+}
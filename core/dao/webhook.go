@@ -0,0 +1,110 @@
+package dao
+
+import (
+	"context"
+	"github.com/gnasnik/titan-workerd-api/core/generated/model"
+	"time"
+)
+
+func AddWebhook(ctx context.Context, webhook *model.Webhook) error {
+	_, err := DB.NamedExecContext(ctx, `
+		INSERT INTO webhook (webhook_id, user_id, url, secret, events, enabled, created_at, updated_at)
+			VALUES (:webhook_id, :user_id, :url, :secret, :events, :enabled, now(), now());`,
+		webhook)
+	return err
+}
+
+func GetWebhookById(ctx context.Context, webhookId string) (*model.Webhook, error) {
+	var out model.Webhook
+	if err := DB.GetContext(ctx, &out, `SELECT * FROM webhook WHERE webhook_id = ?`, webhookId); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func GetWebhooksByUserId(ctx context.Context, userId string) ([]*model.Webhook, error) {
+	var out []*model.Webhook
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM webhook WHERE user_id = ? order by id`, userId)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func DeleteWebhook(ctx context.Context, webhookId string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM webhook WHERE webhook_id = ?`, webhookId)
+	return err
+}
+
+func AddWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	_, err := DB.NamedExecContext(ctx, `
+		INSERT INTO webhook_delivery (delivery_id, webhook_id, event, payload, status, attempts, status_code, error, next_attempt_at, created_at, updated_at)
+			VALUES (:delivery_id, :webhook_id, :event, :payload, :status, :attempts, :status_code, :error, :next_attempt_at, now(), now());`,
+		delivery)
+	return err
+}
+
+func UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	_, err := DB.NamedExecContext(ctx, `
+		UPDATE webhook_delivery SET status = :status, attempts = :attempts, status_code = :status_code, error = :error,
+			next_attempt_at = :next_attempt_at, updated_at = now() WHERE delivery_id = :delivery_id`,
+		delivery)
+	return err
+}
+
+func GetWebhookDeliveryById(ctx context.Context, deliveryId string) (*model.WebhookDelivery, error) {
+	var out model.WebhookDelivery
+	if err := DB.GetContext(ctx, &out, `SELECT * FROM webhook_delivery WHERE delivery_id = ?`, deliveryId); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	var out []*model.WebhookDelivery
+	err := DB.SelectContext(ctx, &out, `SELECT * FROM webhook_delivery WHERE status = ? AND next_attempt_at <= ? order by id LIMIT ?`,
+		model.DeliveryStatusPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func GetWebhookDeliveries(ctx context.Context, webhookId, status string, option QueryOption) (int64, []*model.WebhookDelivery, error) {
+	var total int64
+	var out []*model.WebhookDelivery
+
+	limit := option.PageSize
+	offset := option.Page
+	if option.PageSize <= 0 {
+		limit = 50
+	}
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	where := `webhook_id = ?`
+	args := []interface{}{webhookId}
+
+	if status != "" {
+		where += ` AND status = ?`
+		args = append(args, status)
+	}
+
+	err := DB.GetContext(ctx, &total, `SELECT count(*) FROM webhook_delivery WHERE `+where, args...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = DB.SelectContext(ctx, &out, `SELECT * FROM webhook_delivery WHERE `+where+` order by id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return total, out, nil
+}
+
+func DeleteWebhookDeliveries(ctx context.Context, webhookId string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM webhook_delivery WHERE webhook_id = ?`, webhookId)
+	return err
+}
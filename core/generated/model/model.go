@@ -79,3 +79,88 @@ type ProjectTunnel struct {
 	TunnelIndex int64  `db:"tunnel_index" json:"tunnel_index"`
 	WsURL       string `db:"ws_url" json:"ws_url"`
 }
+
+const (
+	UserRoleDefault = iota
+	UserRoleAdmin
+)
+
+const (
+	LabelOperatorEquals    = "="
+	LabelOperatorNotEquals = "!="
+	LabelOperatorExists    = "exists"
+)
+
+// LabelRequirement is a single term of a label selector such as `env=prod`, `env!=prod` or `env`.
+type LabelRequirement struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+const (
+	ProjectRoleViewer   = "viewer"
+	ProjectRoleDeployer = "deployer"
+	ProjectRoleOwner    = "owner"
+)
+
+// OrgUsage is the resources used by the projects of an organization.
+type OrgUsage struct {
+	Projects int64 `db:"projects" json:"projects"`
+	Replicas int64 `db:"replicas" json:"replicas"`
+}
+
+const (
+	AutoscaleStatusApplied = "applied"
+	AutoscaleStatusFailed  = "failed"
+)
+
+const (
+	HealthCheckModeTunnel = "tunnel"
+	HealthCheckModeNode   = "node"
+)
+
+const (
+	RolloutStrategyCanary    = "canary"
+	RolloutStrategyBlueGreen = "blue_green"
+)
+
+const (
+	RolloutStatusRunning   = "running"
+	RolloutStatusPaused    = "paused"
+	RolloutStatusSucceeded = "succeeded"
+	RolloutStatusFailed    = "failed"
+	RolloutStatusAborted   = "aborted"
+)
+
+const (
+	EventProjectCreated  = "project.created"
+	EventProjectDeployed = "project.deployed"
+	EventProjectFailed   = "project.failed"
+	EventProjectExpired  = "project.expired"
+	EventProjectDeleted  = "project.deleted"
+	EventQuotaWarning    = "quota.warning"
+	EventPing            = "ping"
+)
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	// DeliveryStatusDead marks a delivery given up after its last attempt.
+	DeliveryStatusDead = "dead"
+)
+
+const (
+	MigrationStatusRunning   = "running"
+	MigrationStatusSucceeded = "succeeded"
+	MigrationStatusFailed    = "failed"
+	MigrationStatusCanceled  = "canceled"
+)
+
+const (
+	MigrationTaskPending = "pending"
+	// MigrationTaskDeployed marks a project deployed to the target area and waiting to be healthy there.
+	MigrationTaskDeployed  = "deployed"
+	MigrationTaskSucceeded = "succeeded"
+	MigrationTaskFailed    = "failed"
+)
@@ -8,6 +8,31 @@ import (
 	"time"
 )
 
+type AutoscaleEvent struct {
+	ID           int64     `db:"id" json:"id"`
+	ProjectID    string    `db:"project_id" json:"project_id"`
+	FromReplicas int64     `db:"from_replicas" json:"from_replicas"`
+	ToReplicas   int64     `db:"to_replicas" json:"to_replicas"`
+	Reason       string    `db:"reason" json:"reason"`
+	Status       string    `db:"status" json:"status"`
+	Error        string    `db:"error" json:"error"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+type AutoscalePolicy struct {
+	ID           int64     `db:"id" json:"id"`
+	ProjectID    string    `db:"project_id" json:"project_id"`
+	MinReplicas  int64     `db:"min_replicas" json:"min_replicas"`
+	MaxReplicas  int64     `db:"max_replicas" json:"max_replicas"`
+	Cooldown     int64     `db:"cooldown" json:"cooldown"`
+	Schedules    string    `db:"schedules" json:"schedules"`
+	Rules        string    `db:"rules" json:"rules"`
+	Enabled      bool      `db:"enabled" json:"enabled"`
+	LastScaledAt time.Time `db:"last_scaled_at" json:"last_scaled_at"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
 type LocationCn struct {
 	ID        int64     `db:"id" json:"id"`
 	Ip        string    `db:"ip" json:"ip"`
@@ -42,25 +67,165 @@ type LocationEn struct {
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
 
-type Project struct {
+type MigrationJob struct {
+	ID           int64     `db:"id" json:"id"`
+	JobID        string    `db:"job_id" json:"job_id"`
+	ProjectID    string    `db:"project_id" json:"project_id"`
+	SourceAreaID string    `db:"source_area_id" json:"source_area_id"`
+	TargetAreaID string    `db:"target_area_id" json:"target_area_id"`
+	Status       string    `db:"status" json:"status"`
+	Message      string    `db:"message" json:"message"`
+	CreatedBy    string    `db:"created_by" json:"created_by"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type MigrationTask struct {
 	ID         int64     `db:"id" json:"id"`
-	UserID     string    `db:"user_id" json:"user_id"`
+	JobID      string    `db:"job_id" json:"job_id"`
 	ProjectID  string    `db:"project_id" json:"project_id"`
-	Name       string    `db:"name" json:"name"`
-	AreaID     string    `db:"area_id" json:"area_id"`
-	Region     string    `db:"region" json:"region"`
-	BundleUrl  string    `db:"bundle_url" json:"bundle_url"`
 	Status     string    `db:"status" json:"status"`
 	Replicas   int64     `db:"replicas" json:"replicas"`
-	CpuCores   int32     `db:"cpu_cores" json:"cpu_cores"`
-	Memory     int64     `db:"memory" json:"memory"`
-	Version    int64     `db:"version" json:"version"`
-	Expiration time.Time `db:"expiration" json:"expiration"`
-	NodeIds    string    `db:"node_ids" json:"node_ids"`
+	Message    string    `db:"message" json:"message"`
+	DeployedAt time.Time `db:"deployed_at" json:"deployed_at"`
 	CreatedAt  time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
 }
 
+type Organization struct {
+	ID          int64     `db:"id" json:"id"`
+	OrgID       string    `db:"org_id" json:"org_id"`
+	Name        string    `db:"name" json:"name"`
+	CreatedBy   string    `db:"created_by" json:"created_by"`
+	MaxProjects int64     `db:"max_projects" json:"max_projects"`
+	MaxReplicas int64     `db:"max_replicas" json:"max_replicas"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type OrganizationMember struct {
+	ID        int64     `db:"id" json:"id"`
+	OrgID     string    `db:"org_id" json:"org_id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Role      string    `db:"role" json:"role"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type Project struct {
+	ID          int64     `db:"id" json:"id"`
+	UserID      string    `db:"user_id" json:"user_id"`
+	ProjectID   string    `db:"project_id" json:"project_id"`
+	Name        string    `db:"name" json:"name"`
+	AreaID      string    `db:"area_id" json:"area_id"`
+	Region      string    `db:"region" json:"region"`
+	BundleUrl   string    `db:"bundle_url" json:"bundle_url"`
+	Status      string    `db:"status" json:"status"`
+	Replicas    int64     `db:"replicas" json:"replicas"`
+	CpuCores    int32     `db:"cpu_cores" json:"cpu_cores"`
+	Memory      int64     `db:"memory" json:"memory"`
+	Version     int64     `db:"version" json:"version"`
+	Expiration  time.Time `db:"expiration" json:"expiration"`
+	NodeIds     string    `db:"node_ids" json:"node_ids"`
+	Description string    `db:"description" json:"description"`
+	OrgID       string    `db:"org_id" json:"org_id"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type ProjectGrant struct {
+	ID        int64     `db:"id" json:"id"`
+	ProjectID string    `db:"project_id" json:"project_id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Role      string    `db:"role" json:"role"`
+	GrantedBy string    `db:"granted_by" json:"granted_by"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type ProjectHealthCheck struct {
+	ID                  int64     `db:"id" json:"id"`
+	ProjectID           string    `db:"project_id" json:"project_id"`
+	Mode                string    `db:"mode" json:"mode"`
+	Path                string    `db:"path" json:"path"`
+	Port                int64     `db:"port" json:"port"`
+	ExpectedStatus      int64     `db:"expected_status" json:"expected_status"`
+	CheckInterval       int64     `db:"check_interval" json:"check_interval"`
+	Timeout             int64     `db:"timeout" json:"timeout"`
+	FailureThreshold    int64     `db:"failure_threshold" json:"failure_threshold"`
+	Remediate           bool      `db:"remediate" json:"remediate"`
+	Enabled             bool      `db:"enabled" json:"enabled"`
+	ConsecutiveFailures int64     `db:"consecutive_failures" json:"consecutive_failures"`
+	LastCheckedAt       time.Time `db:"last_checked_at" json:"last_checked_at"`
+	CreatedAt           time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt           time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type ProjectHealthRecord struct {
+	ID         int64     `db:"id" json:"id"`
+	ProjectID  string    `db:"project_id" json:"project_id"`
+	Target     string    `db:"target" json:"target"`
+	NodeID     string    `db:"node_id" json:"node_id"`
+	Healthy    bool      `db:"healthy" json:"healthy"`
+	StatusCode int64     `db:"status_code" json:"status_code"`
+	Latency    int64     `db:"latency" json:"latency"`
+	Error      string    `db:"error" json:"error"`
+	Redeployed bool      `db:"redeployed" json:"redeployed"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+type ProjectLabel struct {
+	ID         int64     `db:"id" json:"id"`
+	ProjectID  string    `db:"project_id" json:"project_id"`
+	LabelKey   string    `db:"label_key" json:"label_key"`
+	LabelValue string    `db:"label_value" json:"label_value"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+type ProjectPlacement struct {
+	ID        int64     `db:"id" json:"id"`
+	ProjectID string    `db:"project_id" json:"project_id"`
+	AreaID    string    `db:"area_id" json:"area_id"`
+	Replicas  int64     `db:"replicas" json:"replicas"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type ProjectRollout struct {
+	ID                int64     `db:"id" json:"id"`
+	RolloutID         string    `db:"rollout_id" json:"rollout_id"`
+	ProjectID         string    `db:"project_id" json:"project_id"`
+	Strategy          string    `db:"strategy" json:"strategy"`
+	Status            string    `db:"status" json:"status"`
+	BundleUrl         string    `db:"bundle_url" json:"bundle_url"`
+	PreviousBundleUrl string    `db:"previous_bundle_url" json:"previous_bundle_url"`
+	Steps             string    `db:"steps" json:"steps"`
+	Step              int64     `db:"step" json:"step"`
+	StepWait          int64     `db:"step_wait" json:"step_wait"`
+	TargetProjectID   string    `db:"target_project_id" json:"target_project_id"`
+	Message           string    `db:"message" json:"message"`
+	CreatedBy         string    `db:"created_by" json:"created_by"`
+	NextStepAt        time.Time `db:"next_step_at" json:"next_step_at"`
+	CreatedAt         time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt         time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type ProjectTemplate struct {
+	ID          int64     `db:"id" json:"id"`
+	TemplateID  string    `db:"template_id" json:"template_id"`
+	UserID      string    `db:"user_id" json:"user_id"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	BundleUrl   string    `db:"bundle_url" json:"bundle_url"`
+	Replicas    int64     `db:"replicas" json:"replicas"`
+	CpuCores    int32     `db:"cpu_cores" json:"cpu_cores"`
+	Memory      int64     `db:"memory" json:"memory"`
+	Version     int64     `db:"version" json:"version"`
+	Published   bool      `db:"published" json:"published"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
 type User struct {
 	ID              int64     `db:"id" json:"id"`
 	Uuid            string    `db:"uuid" json:"uuid"`
@@ -79,3 +244,30 @@ type User struct {
 	Referrer        string    `db:"referrer" json:"referrer"`
 	ReferrerUserID  string    `db:"referrer_user_id" json:"referrer_user_id"`
 }
+
+type Webhook struct {
+	ID        int64     `db:"id" json:"id"`
+	WebhookID string    `db:"webhook_id" json:"webhook_id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Url       string    `db:"url" json:"url"`
+	Secret    string    `db:"secret" json:"secret"`
+	Events    string    `db:"events" json:"events"`
+	Enabled   bool      `db:"enabled" json:"enabled"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID            int64     `db:"id" json:"id"`
+	DeliveryID    string    `db:"delivery_id" json:"delivery_id"`
+	WebhookID     string    `db:"webhook_id" json:"webhook_id"`
+	Event         string    `db:"event" json:"event"`
+	Payload       string    `db:"payload" json:"payload"`
+	Status        string    `db:"status" json:"status"`
+	Attempts      int64     `db:"attempts" json:"attempts"`
+	StatusCode    int64     `db:"status_code" json:"status_code"`
+	Error         string    `db:"error" json:"error"`
+	NextAttemptAt time.Time `db:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at" json:"updated_at"`
+}
@@ -39,12 +39,262 @@ CREATE TABLE `project` (
 `version` bigint(20) NOT NULL DEFAULT 0,
 `expiration` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
 `node_ids` varchar(256) NOT NULL DEFAULT '',
+`description` text NOT NULL,
+`org_id` varchar(128) NOT NULL DEFAULT '',
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_project_id` (`project_id`) USING BTREE,
+KEY `idx_org_id` (`org_id`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `project_placement`;
+CREATE TABLE `project_placement` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`project_id` varchar(128) NOT NULL DEFAULT '',
+`area_id` varchar(128) NOT NULL DEFAULT '',
+`replicas` bigint(20) NOT NULL DEFAULT 0,
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_project_area` (`project_id`, `area_id`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `project_label`;
+CREATE TABLE `project_label` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`project_id` varchar(128) NOT NULL DEFAULT '',
+`label_key` varchar(64) NOT NULL DEFAULT '',
+`label_value` varchar(128) NOT NULL DEFAULT '',
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_project_key` (`project_id`, `label_key`) USING BTREE,
+KEY `idx_key_value` (`label_key`, `label_value`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `project_grant`;
+CREATE TABLE `project_grant` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`project_id` varchar(128) NOT NULL DEFAULT '',
+`user_id` varchar(128) NOT NULL DEFAULT '',
+`role` varchar(28) NOT NULL DEFAULT '',
+`granted_by` varchar(128) NOT NULL DEFAULT '',
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_project_user` (`project_id`, `user_id`) USING BTREE,
+KEY `idx_user_id` (`user_id`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `organization`;
+CREATE TABLE `organization` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`org_id` varchar(128) NOT NULL DEFAULT '',
+`name` varchar(128) NOT NULL DEFAULT '',
+`created_by` varchar(128) NOT NULL DEFAULT '',
+`max_projects` bigint(20) NOT NULL DEFAULT 0,
+`max_replicas` bigint(20) NOT NULL DEFAULT 0,
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_org_id` (`org_id`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `organization_member`;
+CREATE TABLE `organization_member` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`org_id` varchar(128) NOT NULL DEFAULT '',
+`user_id` varchar(128) NOT NULL DEFAULT '',
+`role` varchar(28) NOT NULL DEFAULT '',
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_org_user` (`org_id`, `user_id`) USING BTREE,
+KEY `idx_user_id` (`user_id`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `project_template`;
+CREATE TABLE `project_template` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`template_id` varchar(128) NOT NULL DEFAULT '',
+`user_id` varchar(128) NOT NULL DEFAULT '',
+`name` varchar(128) NOT NULL DEFAULT '',
+`description` text NOT NULL,
+`bundle_url` text NOT NULL,
+`replicas` bigint(20) NOT NULL DEFAULT 0,
+`cpu_cores` int NOT NULL DEFAULT 0,
+`memory` bigint(20) NOT NULL DEFAULT 0,
+`version` bigint(20) NOT NULL DEFAULT 0,
+`published` tinyint(1) NOT NULL DEFAULT 0,
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_template_id` (`template_id`) USING BTREE,
+KEY `idx_user_id` (`user_id`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `autoscale_policy`;
+CREATE TABLE `autoscale_policy` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`project_id` varchar(128) NOT NULL DEFAULT '',
+`min_replicas` bigint(20) NOT NULL DEFAULT 0,
+`max_replicas` bigint(20) NOT NULL DEFAULT 0,
+`cooldown` bigint(20) NOT NULL DEFAULT 0,
+`schedules` text NOT NULL,
+`rules` text NOT NULL,
+`enabled` tinyint(1) NOT NULL DEFAULT 1,
+`last_scaled_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
 `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
 `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
 PRIMARY KEY (`id`),
 UNIQUE KEY `uniq_project_id` (`project_id`) USING BTREE
 ) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
 
+DROP TABLE IF EXISTS `autoscale_event`;
+CREATE TABLE `autoscale_event` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`project_id` varchar(128) NOT NULL DEFAULT '',
+`from_replicas` bigint(20) NOT NULL DEFAULT 0,
+`to_replicas` bigint(20) NOT NULL DEFAULT 0,
+`reason` text NOT NULL,
+`status` varchar(28) NOT NULL DEFAULT '',
+`error` text NOT NULL,
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+KEY `idx_project_id` (`project_id`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `project_health_check`;
+CREATE TABLE `project_health_check` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`project_id` varchar(128) NOT NULL DEFAULT '',
+`mode` varchar(28) NOT NULL DEFAULT '',
+`path` varchar(256) NOT NULL DEFAULT '',
+`port` bigint(20) NOT NULL DEFAULT 0,
+`expected_status` bigint(20) NOT NULL DEFAULT 0,
+`check_interval` bigint(20) NOT NULL DEFAULT 0,
+`timeout` bigint(20) NOT NULL DEFAULT 0,
+`failure_threshold` bigint(20) NOT NULL DEFAULT 0,
+`remediate` tinyint(1) NOT NULL DEFAULT 0,
+`enabled` tinyint(1) NOT NULL DEFAULT 1,
+`consecutive_failures` bigint(20) NOT NULL DEFAULT 0,
+`last_checked_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_project_id` (`project_id`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `project_health_record`;
+CREATE TABLE `project_health_record` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`project_id` varchar(128) NOT NULL DEFAULT '',
+`target` varchar(256) NOT NULL DEFAULT '',
+`node_id` varchar(128) NOT NULL DEFAULT '',
+`healthy` tinyint(1) NOT NULL DEFAULT 0,
+`status_code` bigint(20) NOT NULL DEFAULT 0,
+`latency` bigint(20) NOT NULL DEFAULT 0,
+`error` text NOT NULL,
+`redeployed` tinyint(1) NOT NULL DEFAULT 0,
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+KEY `idx_project_id` (`project_id`) USING BTREE,
+KEY `idx_created_at` (`created_at`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `project_rollout`;
+CREATE TABLE `project_rollout` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`rollout_id` varchar(128) NOT NULL DEFAULT '',
+`project_id` varchar(128) NOT NULL DEFAULT '',
+`strategy` varchar(28) NOT NULL DEFAULT '',
+`status` varchar(28) NOT NULL DEFAULT '',
+`bundle_url` text NOT NULL,
+`previous_bundle_url` text NOT NULL,
+`steps` text NOT NULL,
+`step` bigint(20) NOT NULL DEFAULT 0,
+`step_wait` bigint(20) NOT NULL DEFAULT 0,
+`target_project_id` varchar(128) NOT NULL DEFAULT '',
+`message` text NOT NULL,
+`created_by` varchar(128) NOT NULL DEFAULT '',
+`next_step_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_rollout_id` (`rollout_id`) USING BTREE,
+KEY `idx_project_id` (`project_id`) USING BTREE,
+KEY `idx_status` (`status`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `webhook`;
+CREATE TABLE `webhook` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`webhook_id` varchar(128) NOT NULL DEFAULT '',
+`user_id` varchar(128) NOT NULL DEFAULT '',
+`url` varchar(512) NOT NULL DEFAULT '',
+`secret` varchar(128) NOT NULL DEFAULT '',
+`events` varchar(512) NOT NULL DEFAULT '',
+`enabled` tinyint(1) NOT NULL DEFAULT 1,
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_webhook_id` (`webhook_id`) USING BTREE,
+KEY `idx_user_id` (`user_id`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `webhook_delivery`;
+CREATE TABLE `webhook_delivery` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`delivery_id` varchar(128) NOT NULL DEFAULT '',
+`webhook_id` varchar(128) NOT NULL DEFAULT '',
+`event` varchar(64) NOT NULL DEFAULT '',
+`payload` text NOT NULL,
+`status` varchar(28) NOT NULL DEFAULT '',
+`attempts` bigint(20) NOT NULL DEFAULT 0,
+`status_code` bigint(20) NOT NULL DEFAULT 0,
+`error` text NOT NULL,
+`next_attempt_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_delivery_id` (`delivery_id`) USING BTREE,
+KEY `idx_webhook_id` (`webhook_id`) USING BTREE,
+KEY `idx_status_next_attempt_at` (`status`, `next_attempt_at`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `migration_job`;
+CREATE TABLE `migration_job` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`job_id` varchar(128) NOT NULL DEFAULT '',
+`project_id` varchar(128) NOT NULL DEFAULT '',
+`source_area_id` varchar(128) NOT NULL DEFAULT '',
+`target_area_id` varchar(128) NOT NULL DEFAULT '',
+`status` varchar(28) NOT NULL DEFAULT '',
+`message` text NOT NULL,
+`created_by` varchar(128) NOT NULL DEFAULT '',
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_job_id` (`job_id`) USING BTREE,
+KEY `idx_status` (`status`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `migration_task`;
+CREATE TABLE `migration_task` (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`job_id` varchar(128) NOT NULL DEFAULT '',
+`project_id` varchar(128) NOT NULL DEFAULT '',
+`status` varchar(28) NOT NULL DEFAULT '',
+`replicas` bigint(20) NOT NULL DEFAULT 0,
+`message` text NOT NULL,
+`deployed_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+`updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_job_project` (`job_id`, `project_id`) USING BTREE,
+KEY `idx_status` (`status`) USING BTREE
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
+
 
 -- ----------------------------
 -- Table structure for location_cn